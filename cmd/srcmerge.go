@@ -2,24 +2,206 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/tfaller/go-srcmerge/internal/cmd"
+	"github.com/tfaller/go-srcmerge/pkg"
 	"github.com/tfaller/go-srcmerge/pkg/sliceflag"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "regen":
+			regen(os.Args[2:])
+			return
+		case "extract":
+			extract(os.Args[2:])
+			return
+		case "split":
+			split(os.Args[2:])
+			return
+		}
+	}
+	merge()
+}
+
+// regen merges the source files of merged files again
+func regen(args []string) {
+	flags := flag.NewFlagSet("regen", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: srcmerge regen out.go...\n")
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	for _, outFile := range flags.Args() {
+		if err := cmd.Regen(outFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// extract writes symbols of a package and their dependencies into a file
+func extract(args []string) {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: srcmerge extract -sym Foo -from ./pkg -o foo.go\n")
+		flags.PrintDefaults()
+	}
+	symbols := sliceflag.StringSliceFlag{}
+	flags.Var(&symbols, "sym", "symbol to extract, e.g. Foo, Foo.Bar or 'New*' (can be set multiple time)")
+	from := flags.String("from", "", "go source file, package directory or import path")
+	packageName := flags.String("p", "", "package name, defaults to the name of the source package")
+	outFile := flags.String("o", "", "out file")
+	header := flags.Bool("header", true, "add a generated code header with the manifest of the extraction")
+	flags.Parse(args)
+	if len(symbols) == 0 || *from == "" || *outFile == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	options := cmd.Options{Header: *header}
+	if err := cmd.Extract(symbols, *from, *outFile, *packageName, options); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// split splits merged files into multiple files
+func split(args []string) {
+	flags := flag.NewFlagSet("split", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: srcmerge split [-strategy origin|type|max] [-max n] -o dir out.go...\n")
+		flags.PrintDefaults()
+	}
+	strategyName := flags.String("strategy", "origin", "split strategy: origin (needs provenance), type or max")
+	max := flags.Int("max", 0, "maximum number of declarations per file of the max strategy")
+	packageName := flags.String("p", "", "package name, defaults to the package name of the merged file")
+	outDir := flags.String("o", ".", "out directory")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	strategy, err := pkg.ParseSplitStrategy(*strategyName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, mergedFile := range flags.Args() {
+		if err := cmd.Split(mergedFile, *outDir, strategy, *max, *packageName); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func merge() {
 	srcFilesNames := sliceflag.StringSliceFlag{}
-	flag.Var(&srcFilesNames, "f", "go source file (can be set multiple time)")
+	flag.Var(&srcFilesNames, "f", "go source file, package directory or import pattern (can be set multiple time)")
 
 	srcRefactorName := sliceflag.StringSliceFlag{}
-	flag.Var(&srcRefactorName, "r", "refactor name for a given source file (can be set multiple time)")
+	flag.Var(&srcRefactorName, "r", "refactor name for a given source file, defaults to the package name (can be set multiple time)")
+
+	keep := sliceflag.StringSliceFlag{}
+	flag.Var(&keep, "keep", "keep only declarations reachable from the root, e.g. main, NewClient or '[A-Z]*' (can be set multiple time)")
+
+	bundles := sliceflag.StringSliceFlag{}
+	flag.Var(&bundles, "bundle", "import path of a dependency to bundle with prefixed declarations (can be set multiple time)")
+
+	importRewrites := sliceflag.StringSliceFlag{}
+	flag.Var(&importRewrites, "rewrite", "rewrite import path prefix old=new (can be set multiple time)")
+
+	allowImports := sliceflag.StringSliceFlag{}
+	flag.Var(&allowImports, "allow", "allowed import path prefix, \"std\" for the standard library (can be set multiple time)")
 
+	denyImports := sliceflag.StringSliceFlag{}
+	flag.Var(&denyImports, "deny", "forbidden import path prefix (can be set multiple time)")
+
+	order := flag.String("order", "source", "order of the declarations: source, kind, type, alpha or dependency")
+	provenance := flag.Bool("provenance", false, "annotate declarations with their origin")
+	lineDirectives := flag.Bool("line", false, "add //line directives which refer to the source files")
+	sourceMap := flag.Bool("sourcemap", false, "write a json source map next to the out file")
+	typeCheck := flag.Bool("check", false, "type check the merged file before it gets written")
+	apiCheck := flag.Bool("apicheck", false, "fail if the merged file doesn't provide the exported API of all source files")
+	apiReport := flag.String("apireport", "", "write a json report of the API changes to the file, \"-\" for stdout")
+	report := flag.String("report", "", "write a json report of every merge decision to the file, \"-\" for stdout")
+	bundlePrefix := flag.String("prefix", "", "prefix of the declarations of bundled packages, defaults to the package name, which is appended with multiple bundles")
+	tests := flag.Bool("tests", false, "merge the _test.go files of packages too")
+	header := flag.Bool("header", true, "add a generated code header with the manifest of the merge")
+	constraints := flag.String("constraints", "combine", "build constraint handling: combine, select or split")
+	goos := flag.String("goos", "", "target GOOS of -constraints select")
+	goarch := flag.String("goarch", "", "target GOARCH of -constraints select")
+	tags := flag.String("tags", "", "comma separated build tags of -constraints select")
+	files := flag.String("files", "", "write an out directory with one file per source file (origin), per type or with at most -maxdecls declarations (max)")
+	maxDecls := flag.Int("maxdecls", 0, "maximum number of declarations per file of -files max")
+	verbose := flag.Bool("v", false, "log every merge event, e.g. removed duplicates")
+	quiet := flag.Bool("q", false, "log only warnings")
 	packageName := flag.String("p", "merged", "package name")
-	outFile := flag.String("o", "", "out file")
+	outFile := flag.String("o", "", "out file, or directory with -files")
 	flag.Parse()
 
-	err := cmd.Merge(srcFilesNames, srcRefactorName, *outFile, *packageName)
+	options := cmd.Options{}
+	options.Provenance = *provenance
+	options.LineDirectives = *lineDirectives
+	options.SourceMap = *sourceMap
+	options.Header = *header
+	options.TypeCheck = *typeCheck
+	options.Tests = *tests
+	options.Bundle = bundles
+	options.Keep = keep
+	options.BundlePrefix = *bundlePrefix
+	options.APICheck = *apiCheck
+	options.APIReport = *apiReport
+	options.Report = *report
+	events := pkg.LogHandler{Level: pkg.LevelInfo}
+	if *verbose {
+		events.Level = pkg.LevelDebug
+	}
+	if *quiet {
+		events.Level = pkg.LevelWarn
+	}
+	options.Events = events
+	options.ImportPolicy.Allow = allowImports
+	options.ImportPolicy.Deny = denyImports
+	var err error
+	options.Order, err = pkg.ParseDeclOrder(*order)
+	if err != nil {
+		log.Fatal(err)
+	}
+	options.Constraints, err = pkg.ParseConstraintMode(*constraints)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *files != "" {
+		if options.Files, err = pkg.ParseSplitStrategy(*files); err != nil {
+			log.Fatal(err)
+		}
+		options.MaxDecls = *maxDecls
+	}
+	options.GOOS = *goos
+	options.GOARCH = *goarch
+	if *tags != "" {
+		options.Tags = strings.Split(*tags, ",")
+	}
+	for _, rule := range importRewrites {
+		r, err := pkg.ParseImportRewrite(rule)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.ImportRewrites = append(options.ImportRewrites, r)
+	}
+
+	for len(srcRefactorName) < len(srcFilesNames) {
+		// the package name is the default
+		srcRefactorName = append(srcRefactorName, "")
+	}
+
+	err = cmd.Merge(srcFilesNames, srcRefactorName, *outFile, *packageName, options)
 	if err != nil {
 		log.Fatal(err)
 	}
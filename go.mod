@@ -1,3 +1,5 @@
 module github.com/tfaller/go-srcmerge
 
 go 1.18
+
+require golang.org/x/tools v0.9.1
@@ -0,0 +1,23 @@
+package cmd
+
+import "fmt"
+
+// Extract writes the symbols of a package and everything they depend on
+// into the out file. The package name defaults to the name of the source package.
+func Extract(symbols []string, from, outFile, packageName string, options Options) error {
+	if len(symbols) == 0 {
+		return fmt.Errorf("no symbol specified")
+	}
+	if packageName == "" {
+		inputs, err := resolveInputs([]string{from}, []string{""}, options)
+		if err != nil {
+			return err
+		}
+		if len(inputs) != 1 {
+			return fmt.Errorf("%v must be a single package", from)
+		}
+		packageName = inputs[0].Package
+	}
+	options.Extract = symbols
+	return Merge([]string{from}, []string{""}, outFile, packageName, options)
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GeneratedHeader marks the merged file as generated
+const GeneratedHeader = "// Code generated by srcmerge. DO NOT EDIT."
+
+// ManifestDirective prefixes the manifest in the header of a merged file
+const ManifestDirective = "//srcmerge:manifest "
+
+// Manifest contains everything to reproduce a merge.
+type Manifest struct {
+	// Files are relative to the directory of the merged file,
+	// import paths of packages are kept as they are
+	Files     []string `json:"files"`
+	Postfixes []string `json:"postfixes"`
+	Package   string   `json:"package"`
+	Options   Options  `json:"options"`
+}
+
+// newManifest creates the manifest of a merge. The source file names get relative
+// to the directory of the merged file, or the out directory of a multi-file merge.
+func newManifest(srcFilesNames, srcRefactorName []string, outFile, packageName string, options Options) (*Manifest, error) {
+	if options.Files == "" {
+		outFile = filepath.Dir(outFile)
+	}
+	outDir, err := filepath.Abs(outFile)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, len(srcFilesNames))
+	for i, srcFile := range srcFilesNames {
+		if !isLocal(srcFile) {
+			files[i] = srcFile
+			continue
+		}
+		abs, err := filepath.Abs(srcFile)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(outDir, abs)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = filepath.ToSlash(rel)
+		if !isGoFile(srcFile) && !strings.HasPrefix(files[i], ".") {
+			// a package directory must not look like an import path
+			files[i] = "./" + files[i]
+		}
+	}
+	return &Manifest{Files: files, Postfixes: srcRefactorName, Package: packageName, Options: options}, nil
+}
+
+// header returns the generated header with the manifest
+func (m *Manifest) header() (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return GeneratedHeader + "\n" + ManifestDirective + string(data), nil
+}
+
+// ReadManifest reads the manifest of a merged file.
+func ReadManifest(outFile string) (*Manifest, error) {
+	f, err := os.Open(outFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		if data := strings.TrimPrefix(line, ManifestDirective); data != line {
+			manifest := &Manifest{}
+			if err := json.Unmarshal([]byte(data), manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			return manifest, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%v has no srcmerge manifest", outFile)
+}
+
+// Regen merges the source files of a merged file, or of an out directory
+// of a multi-file merge, again.
+func Regen(outFile string) error {
+	outDir := filepath.Dir(outFile)
+	manifestFile := outFile
+	if info, err := os.Stat(outFile); err == nil && info.IsDir() {
+		// each generated file of the directory has the manifest
+		files, err := generatedFiles(outFile)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("%v has no generated go files", outFile)
+		}
+		outDir, manifestFile = outFile, files[0]
+	}
+	manifest, err := ReadManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	files := make([]string, len(manifest.Files))
+	for i, file := range manifest.Files {
+		if strings.HasSuffix(file, ".go") || strings.HasPrefix(file, ".") {
+			files[i] = filepath.Join(outDir, filepath.FromSlash(file))
+		} else {
+			files[i] = file
+		}
+	}
+	return Merge(files, manifest.Postfixes, outFile, manifest.Package, manifest.Options)
+}
+
+// generatedFiles returns the go files of a directory, which have a manifest
+func generatedFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	generated := []string{}
+	for _, file := range files {
+		if _, err := ReadManifest(file); err == nil {
+			generated = append(generated, file)
+		}
+	}
+	return generated, nil
+}
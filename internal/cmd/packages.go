@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tfaller/go-srcmerge/pkg"
+)
+
+// Input is a source file or the files of a package, which get merged together.
+type Input struct {
+	// Name is the source file, the package directory or the import path
+	Name string
+	// ImportPath is only known for packages
+	ImportPath string
+	Package    string
+	Files      []string
+	Postfix    string
+	// Prefix of the declarations, if the package gets bundled
+	Prefix string
+}
+
+// listedPackage is the output of go list
+type listedPackage struct {
+	Dir            string
+	ImportPath     string
+	Name           string
+	Standard       bool
+	GoFiles        []string
+	CgoFiles       []string
+	IgnoredGoFiles []string
+	TestGoFiles    []string
+}
+
+// resolveInputs resolves the source files, package directories and import patterns
+// to the files to merge. An empty postfix gets the package name. Only the files of
+// directories and import patterns are merged as one package, each source file
+// is merged on its own, so that duplicates between files are removed.
+func resolveInputs(srcs, postfixes []string, options Options) ([]Input, error) {
+	inputs := []Input{}
+	for i, src := range srcs {
+		if isGoFile(src) {
+			file, err := parser.ParseFile(token.NewFileSet(), src, nil, parser.PackageClauseOnly)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, Input{Name: src, Package: file.Name.Name, Files: []string{src}, Postfix: postfixes[i]})
+			continue
+		}
+
+		pkgs, err := listPackages(src, options, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pkgs {
+			postfix := postfixes[i]
+			if postfix != "" && len(pkgs) > 1 {
+				// each package of a pattern needs its own postfix
+				postfix += exportedName(p.Name)
+			}
+			inputs = append(inputs, Input{Name: p.ImportPath, ImportPath: p.ImportPath, Package: p.Name, Files: p.files(options), Postfix: postfix})
+		}
+	}
+
+	used := map[string]bool{}
+	for i := range inputs {
+		if inputs[i].Postfix != "" {
+			used[inputs[i].Postfix] = true
+		}
+	}
+	for i := range inputs {
+		if inputs[i].Postfix != "" {
+			continue
+		}
+		postfix := exportedName(inputs[i].Package)
+		for n := 2; used[postfix]; n++ {
+			postfix = exportedName(inputs[i].Package) + strconv.Itoa(n)
+		}
+		used[postfix] = true
+		inputs[i].Postfix = postfix
+	}
+	return inputs, nil
+}
+
+// resolveBundles resolves the packages to bundle. Internal packages,
+// which are imported by a bundled package, get bundled too. Each bundle
+// gets its own prefix, so that the declarations of bundles don't collide.
+// A package is bundled only once, even if it is an internal package of another bundle.
+func resolveBundles(options Options) ([]Input, error) {
+	inputs := []Input{}
+	used := map[string]bool{}
+	bundled := map[string]bool{}
+	for _, bundle := range options.Bundle {
+		pkgs, err := listPackages(bundle, options, true)
+		if err != nil {
+			return nil, err
+		}
+		name := ""
+		for _, p := range pkgs {
+			if p.ImportPath == bundle {
+				name = p.Name
+			}
+		}
+		prefix := options.BundlePrefix
+		if prefix == "" {
+			prefix = name
+		} else if len(options.Bundle) > 1 {
+			// each bundle needs its own prefix
+			prefix += exportedName(name)
+		}
+		unique := prefix
+		for n := 2; used[unique]; n++ {
+			unique = prefix + strconv.Itoa(n)
+		}
+		used[unique] = true
+		prefix = unique
+
+		for _, p := range pkgs {
+			if p.Standard || bundled[p.ImportPath] || (p.ImportPath != bundle && !isInternalOf(p.ImportPath, bundle)) {
+				continue
+			}
+			bundled[p.ImportPath] = true
+			input := Input{Name: p.ImportPath, ImportPath: p.ImportPath, Package: p.Name, Files: p.files(options), Prefix: prefix}
+			if p.ImportPath != bundle {
+				input.Prefix += p.Name
+			}
+			input.Postfix = exportedName(input.Prefix)
+			inputs = append(inputs, input)
+		}
+	}
+	return inputs, nil
+}
+
+// isInternalOf checks whether a package is an internal package, which may be imported by the importer
+func isInternalOf(pkgPath, importer string) bool {
+	i := strings.LastIndex(pkgPath, "/internal/")
+	if i < 0 && strings.HasSuffix(pkgPath, "/internal") {
+		i = len(pkgPath) - len("/internal")
+	}
+	if i < 0 {
+		return false
+	}
+	parent := pkgPath[:i]
+	return importer == parent || strings.HasPrefix(importer, parent+"/")
+}
+
+// listPackages lists the packages of a directory or import pattern with go list.
+// With deps, the dependencies get listed too, before the packages which import them.
+func listPackages(pattern string, options Options, deps bool) ([]listedPackage, error) {
+	if isLocal(pattern) && !filepath.IsAbs(pattern) && !strings.HasPrefix(pattern, ".") {
+		// go list would interpret it as an import path
+		pattern = "./" + filepath.ToSlash(pattern)
+	}
+
+	args := []string{"list", "-json"}
+	if deps {
+		args = append(args, "-deps")
+	}
+	cmd := exec.Command("go")
+	// packages are resolved offline from the module cache or vendor directory
+	cmd.Env = append(os.Environ(), "GOPROXY=off")
+	if options.Constraints == pkg.ConstraintSelect {
+		if options.GOOS != "" {
+			cmd.Env = append(cmd.Env, "GOOS="+options.GOOS)
+		}
+		if options.GOARCH != "" {
+			cmd.Env = append(cmd.Env, "GOARCH="+options.GOARCH)
+		}
+		if len(options.Tags) > 0 {
+			args = append(args, "-tags", strings.Join(options.Tags, ","))
+		}
+	}
+	cmd.Args = append(append(cmd.Args, args...), pattern)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list %v: %w\n%s", pattern, err, stderr)
+	}
+
+	pkgs := []listedPackage{}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		p := listedPackage{}
+		if err := dec.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(p.GoFiles)+len(p.CgoFiles) == 0 {
+			continue
+		}
+		pkgs = append(pkgs, p)
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("%v matched no packages", pattern)
+	}
+	return pkgs, nil
+}
+
+// files returns the files of the package to merge
+func (p listedPackage) files(options Options) []string {
+	names := append(append([]string{}, p.GoFiles...), p.CgoFiles...)
+	if options.Tests {
+		names = append(names, p.TestGoFiles...)
+	}
+	if options.Constraints == pkg.ConstraintSplit {
+		// the files of all constraints are needed ... but
+		// not ignored files of other packages, like generators
+		for _, name := range p.IgnoredGoFiles {
+			file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(p.Dir, name), nil, parser.PackageClauseOnly)
+			if err == nil && file.Name.Name == p.Name && (options.Tests || !strings.HasSuffix(name, "_test.go")) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	files := make([]string, len(names))
+	for i, name := range names {
+		files[i] = filepath.Join(p.Dir, name)
+	}
+	return files
+}
+
+// isGoFile checks whether a source is a single go file
+func isGoFile(src string) bool {
+	info, err := os.Stat(src)
+	return err == nil && !info.IsDir() && strings.HasSuffix(src, ".go")
+}
+
+// isLocal checks whether a source is a file, a directory or a
+// pattern of directories instead of an import path
+func isLocal(src string) bool {
+	if filepath.IsAbs(src) || strings.HasPrefix(src, ".") {
+		return true
+	}
+	_, err := os.Stat(strings.TrimSuffix(strings.TrimSuffix(src, "..."), "/"))
+	return err == nil
+}
+
+// exportedName upper cases the first letter of a name
+func exportedName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
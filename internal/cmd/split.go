@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/tfaller/go-srcmerge/pkg"
+)
+
+// Split splits a merged file into multiple files in the out directory.
+// The package name is optional, it replaces the package name of the merged file.
+func Split(mergedFile, outDir string, strategy pkg.SplitStrategy, max int, packageName string) error {
+	src, err := os.ReadFile(mergedFile)
+	if err != nil {
+		return err
+	}
+	files, err := pkg.Split(src, mergedFile, strategy, max, packageName)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fileName := filepath.Join(outDir, filepath.FromSlash(file.Name))
+		if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(fileName, file.Src, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
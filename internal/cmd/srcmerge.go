@@ -1,13 +1,82 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"go/build/constraint"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/tfaller/go-srcmerge/pkg"
 )
 
-func Merge(srcFilesNames []string, srcRefactorName []string, outFile, packageName string) error {
+// Options of a merge
+type Options struct {
+	pkg.Options
+
+	// SourceMap writes a json source map next to the merged file
+	SourceMap bool `json:"sourceMap,omitempty"`
+
+	// Header adds the generated code header with the manifest of the merge
+	Header bool `json:"header,omitempty"`
+
+	// TypeCheck type checks the merged file before it gets written
+	TypeCheck bool `json:"typeCheck,omitempty"`
+
+	// APICheck fails the merge if the merged file doesn't
+	// provide the exported API of all source files
+	APICheck bool `json:"apiCheck,omitempty"`
+
+	// APIReport is the file the json API report gets written to, "-" is stdout
+	APIReport string `json:"apiReport,omitempty"`
+
+	// Report is the file the json report of the merge decisions gets written to, "-" is stdout
+	Report string `json:"report,omitempty"`
+
+	// Events handles the events of the merge, they are logged if it isn't set
+	Events pkg.EventHandler `json:"-"`
+
+	// Tests merges the _test.go files of packages too
+	Tests bool `json:"tests,omitempty"`
+
+	// Keep are the roots of the declarations to keep,
+	// everything which isn't reachable from them is removed
+	Keep []string `json:"keep,omitempty"`
+
+	// Extract are the declarations to extract, together with
+	// everything they depend on
+	Extract []string `json:"extract,omitempty"`
+
+	// Bundle are import paths of dependencies, which get merged
+	// with prefixed declarations
+	Bundle []string `json:"bundle,omitempty"`
+
+	// BundlePrefix of the declarations of bundled packages, defaults to the
+	// package name. With multiple bundles, the package name is appended.
+	BundlePrefix string `json:"bundlePrefix,omitempty"`
+
+	// Files writes the merged package into the out directory instead of a single
+	// file, with one file per source file (origin), per type or with at most MaxDecls
+	// declarations per file. Declarations of multiple source files go into a common.go.
+	Files pkg.SplitStrategy `json:"files,omitempty"`
+
+	// MaxDecls is the maximum number of declarations per file of the max strategy
+	MaxDecls int `json:"maxDecls,omitempty"`
+}
+
+// SourceMapExt is appended to the name of the merged file
+// to get the name of the source map.
+const SourceMapExt = ".map"
+
+// Merge merges the source files into the out file. A source can be a file,
+// a package directory or an import pattern, an empty postfix gets the package name.
+func Merge(srcFilesNames []string, srcRefactorName []string, outFile, packageName string, options Options) error {
 
 	if len(srcFilesNames) == 0 {
 		return fmt.Errorf("no source file specified")
@@ -17,18 +86,255 @@ func Merge(srcFilesNames []string, srcRefactorName []string, outFile, packageNam
 		return fmt.Errorf("for each source file must be refactor name set")
 	}
 
-	merger := pkg.NewMerger(packageName)
+	if options.Files != "" && options.SourceMap {
+		return fmt.Errorf("a source map needs a single out file")
+	}
+	if options.Files != "" && options.Constraints == pkg.ConstraintSplit {
+		return fmt.Errorf("build constraint groups need a single out file")
+	}
+
+	inputs, err := resolveInputs(srcFilesNames, srcRefactorName, options)
+	if err != nil {
+		return err
+	}
+	bundles, err := resolveBundles(options)
+	if err != nil {
+		return err
+	}
+	inputs = append(inputs, bundles...)
+
+	if options.Constraints == pkg.ConstraintSplit {
+		return mergeConstraintGroups(inputs, outFile, packageName, options)
+	}
+
+	var manifest *Manifest
+	if options.Header {
+		manifest, err = newManifest(srcFilesNames, srcRefactorName, outFile, packageName, options)
+		if err != nil {
+			return err
+		}
+	}
+	return merge(inputs, manifest, outFile, packageName, options)
+}
+
+func merge(inputs []Input, manifest *Manifest, outFile, packageName string, options Options) error {
+	mergeOptions := pkg.MergeOptions{
+		Options:     options.Options,
+		PackageName: packageName,
+		FileName:    outFile,
+		BaseDir:     filepath.Dir(outFile),
+		Keep:        options.Keep,
+		Extract:     options.Extract,
+		TypeCheck:   options.TypeCheck,
+		// dependencies are type checked from source, export data
+		// of module dependencies isn't available without a build
+		Importer: importer.ForCompiler(token.NewFileSet(), "source", nil),
+		Events:   options.Events,
+	}
+	if mergeOptions.Events == nil {
+		mergeOptions.Events = pkg.LogHandler{}
+	}
+	if options.Files != "" {
+		mergeOptions.BaseDir = outFile
+		mergeOptions.Files = options.Files
+		mergeOptions.MaxDecls = options.MaxDecls
+	}
+	if manifest != nil {
+		var err error
+		if mergeOptions.Header, err = manifest.header(); err != nil {
+			return err
+		}
+	}
+
+	sources := []pkg.Source{}
+	for _, input := range inputs {
+		for i, srcFile := range input.Files {
+			src, err := os.ReadFile(srcFile)
+			if err != nil {
+				return err
+			}
+			sources = append(sources, pkg.Source{
+				Name:        srcFile,
+				Src:         src,
+				Postfix:     input.Postfix,
+				SamePackage: i > 0,
+				ImportPath:  input.ImportPath,
+				Prefix:      input.Prefix,
+			})
+		}
+	}
+
+	result, err := pkg.MergeSources(context.Background(), sources, mergeOptions)
+	if err != nil {
+		return err
+	}
+
+	if options.Report != "" {
+		if err := writeReport(options.Report, result.Report); err != nil {
+			return err
+		}
+	}
+
+	src := result.Src
+	if options.APICheck || options.APIReport != "" {
+		mergedPkg := result.Package
+		if mergedPkg == nil {
+			// the API can be compared even if the merged file has type errors
+			if mergedPkg, err = result.Merger.Check(src, outFile, mergeOptions.Importer); mergedPkg == nil {
+				return err
+			}
+		}
+		if err := checkAPI(result.Merger, mergedPkg, inputs, mergeOptions.Importer, options); err != nil {
+			return err
+		}
+	}
+	if options.Files != "" {
+		return writeFiles(result.Files, outFile)
+	}
+	if err := os.WriteFile(outFile, src, 0644); err != nil {
+		return err
+	}
 
-	for i, srcFile := range srcFilesNames {
-		ast, err := pkg.LoadAstFile(srcFile)
+	if options.SourceMap {
+		sm, err := result.Merger.SourceMap(src, filepath.Base(outFile))
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(sm, "", "\t")
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+		return os.WriteFile(outFile+SourceMapExt, data, 0644)
+	}
+	return nil
+}
+
+// writeFiles writes the files of the merged package into the out directory. The files
+// of a previous merge, which have a manifest, are removed first, so that no stale
+// files remain. Files without a manifest are kept.
+func writeFiles(files []pkg.SplitFile, outDir string) error {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	generated, err := generatedFiles(outDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range generated {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(outDir, file.Name), file.Src, 0644); err != nil {
+			return err
 		}
-		err = merger.Merge(ast, srcRefactorName[i])
+	}
+	return nil
+}
+
+// checkAPI compares the exported API of the source files with the merged package
+func checkAPI(merger *pkg.Merger, mergedPkg *types.Package, inputs []Input, imp types.Importer, options Options) error {
+	changes := []pkg.APIChange{}
+	for _, input := range inputs {
+		srcPkg, err := pkg.TypeCheckFiles(imp, input.Files...)
 		if err != nil {
+			return fmt.Errorf("API of %v can't be compared: %w", input.Name, err)
+		}
+		renames := map[string]string{}
+		for _, srcFile := range input.Files {
+			for original, name := range merger.Renames(srcFile) {
+				renames[original] = name
+			}
+		}
+		changes = append(changes, pkg.CompareAPI(input.Name, srcPkg, mergedPkg, renames)...)
+	}
+	report := pkg.NewAPIReport(changes)
+
+	if options.APIReport != "" {
+		if err := writeReport(options.APIReport, report); err != nil {
 			return err
 		}
 	}
+	if options.APICheck {
+		return report.Err()
+	}
+	return nil
+}
+
+// writeReport writes a json report to the file, "-" is stdout
+func writeReport(fileName string, report interface{}) error {
+	data, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return err
+	}
+	if fileName == "-" {
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	return os.WriteFile(fileName, data, 0644)
+}
+
+// mergeConstraintGroups merges each group of source files with the same build
+// constraint into its own file. The name of the file gets the constraint as suffix.
+func mergeConstraintGroups(inputs []Input, outFile, packageName string, options Options) error {
+	groups := []string{}
+	constraints := map[string]constraint.Expr{}
+	groupInputs := map[string][]Input{}
+
+	for _, input := range inputs {
+		for _, srcFile := range input.Files {
+			file, err := parser.ParseFile(token.NewFileSet(), srcFile, nil, parser.PackageClauseOnly|parser.ParseComments)
+			if err != nil {
+				return err
+			}
+			c, err := pkg.FileConstraint(srcFile, file)
+			if err != nil {
+				return err
+			}
+			key := ""
+			if c != nil {
+				key = c.String()
+			}
+			if _, exists := groupInputs[key]; !exists {
+				groups = append(groups, key)
+				constraints[key] = c
+			}
+			// files of the same package stay together
+			group := groupInputs[key]
+			if last := len(group) - 1; last >= 0 && group[last].Name == input.Name {
+				group[last].Files = append(group[last].Files, srcFile)
+			} else {
+				group = append(group, Input{Name: input.Name, ImportPath: input.ImportPath, Package: input.Package, Files: []string{srcFile}, Postfix: input.Postfix, Prefix: input.Prefix})
+			}
+			groupInputs[key] = group
+		}
+	}
 
-	return pkg.WriteAstFile(outFile, &merger.File)
+	options.Constraints = pkg.ConstraintCombine
+	for _, key := range groups {
+		groupOutFile := strings.TrimSuffix(outFile, ".go") + pkg.ConstraintFileSuffix(constraints[key]) + ".go"
+		var manifest *Manifest
+		if options.Header {
+			files, postfixes := []string{}, []string{}
+			for _, input := range groupInputs[key] {
+				if input.Prefix != "" {
+					// bundles are part of the options
+					continue
+				}
+				for _, srcFile := range input.Files {
+					files = append(files, srcFile)
+					postfixes = append(postfixes, input.Postfix)
+				}
+			}
+			var err error
+			if manifest, err = newManifest(files, postfixes, groupOutFile, packageName, options); err != nil {
+				return err
+			}
+		}
+		if err := merge(groupInputs[key], manifest, groupOutFile, packageName, options); err != nil {
+			return err
+		}
+	}
+	return nil
 }
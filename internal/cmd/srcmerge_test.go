@@ -1,16 +1,31 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
 	"log"
 	"os"
 	"path"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/tfaller/go-srcmerge/pkg"
 )
 
 const TestCaseBasePath = "../../test/merge"
 
+// TestCaseOptions is an optional file of a test case, which
+// contains the merge options as json.
+const TestCaseOptions = "options.json"
+
 func Test(t *testing.T) {
 	tests, err := os.ReadDir(TestCaseBasePath)
 	if err != nil {
@@ -33,6 +48,7 @@ func testMerge(t *testing.T) {
 
 	srcFiles := []string{}
 	refactorNames := []string{}
+	options := Options{}
 
 	for _, entry := range testDirEntries {
 
@@ -43,6 +59,17 @@ func testMerge(t *testing.T) {
 
 		entryPath := path.Join(testBasePath, entry.Name())
 
+		if entry.Name() == TestCaseOptions {
+			data, err := os.ReadFile(entryPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &options); err != nil {
+				t.Fatalf("invalid options: %v", err)
+			}
+			continue
+		}
+
 		if !entry.IsDir() {
 			srcFiles = append(srcFiles, entryPath)
 			refactorNames = append(refactorNames, fmt.Sprint(len(srcFiles)))
@@ -51,6 +78,12 @@ func testMerge(t *testing.T) {
 			if err != nil {
 				log.Fatal(err)
 			}
+			if len(subEntries) > 1 {
+				// the files of a sub dir are merged as one package
+				srcFiles = append(srcFiles, entryPath)
+				refactorNames = append(refactorNames, strings.ToTitle(entry.Name()))
+				continue
+			}
 			for _, subEntry := range subEntries {
 				if subEntry.IsDir() {
 					t.Fatalf("expected no sub dir %v", subEntry.Name())
@@ -61,8 +94,883 @@ func testMerge(t *testing.T) {
 		}
 	}
 
-	err = Merge(srcFiles, refactorNames, path.Join(testBasePath, "out", "out.go"), "out")
+	err = Merge(srcFiles, refactorNames, path.Join(testBasePath, "out", "out.go"), "out", options)
 	if err != nil {
 		t.Error(err)
 	}
 }
+
+func TestImportPolicy(t *testing.T) {
+	srcFiles := []string{path.Join(TestCaseBasePath, "basic", "0.go"), path.Join(TestCaseBasePath, "basic", "1.go")}
+	outFile := path.Join(t.TempDir(), "out.go")
+
+	options := Options{}
+	options.ImportPolicy.Allow = []string{"std"}
+	if err := Merge(srcFiles, []string{"1", "2"}, outFile, "out", options); err != nil {
+		t.Fatalf("std import must be allowed: %v", err)
+	}
+
+	options.ImportPolicy.Deny = []string{"fmt"}
+	err := Merge(srcFiles, []string{"1", "2"}, outFile, "out", options)
+	policyErr, ok := err.(pkg.ErrImportPolicy)
+	if !ok {
+		t.Fatalf("expected import policy error, got %v", err)
+	}
+	if len(policyErr.Violations) != 1 {
+		t.Fatalf("expected one violation, got %v", policyErr.Violations)
+	}
+	v := policyErr.Violations[0]
+	if v.File != srcFiles[0] || v.Path != "fmt" || strings.Join(v.Decls, ",") != "Struct.Hello" {
+		t.Errorf("unexpected violation %v", v)
+	}
+
+	// the violations of all inputs are reported at once
+	testBasePath := path.Join(TestCaseBasePath, "import-alias")
+	srcFiles = []string{path.Join(testBasePath, "0", "0.go"), path.Join(testBasePath, "1", "1.go")}
+	options.ImportPolicy.Deny = []string{"math/rand", "crypto/rand"}
+	err = Merge(srcFiles, []string{"1", "2"}, outFile, "out", options)
+	if policyErr, ok = err.(pkg.ErrImportPolicy); !ok {
+		t.Fatalf("expected import policy error, got %v", err)
+	}
+	if len(policyErr.Violations) != 2 {
+		t.Fatalf("expected two violations, got %v", policyErr.Violations)
+	}
+	for i, v := range policyErr.Violations {
+		if v.File != srcFiles[i] {
+			t.Errorf("unexpected violation %v", v)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	testBasePath := path.Join(TestCaseBasePath, "deterministic")
+	srcFiles := []string{path.Join(testBasePath, "0", "0.go"), path.Join(testBasePath, "1", "1.go")}
+
+	var expected []byte
+	for i := 0; i < 20; i++ {
+		outFile := path.Join(t.TempDir(), "out.go")
+		if err := Merge(srcFiles, []string{"0", "1"}, outFile, "out", Options{}); err != nil {
+			t.Fatal(err)
+		}
+		out, err := os.ReadFile(outFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected == nil {
+			expected = out
+		} else if !bytes.Equal(expected, out) {
+			t.Fatalf("run %v produced a different output:\n%s\n---\n%s", i, expected, out)
+		}
+	}
+}
+
+func TestRegen(t *testing.T) {
+	outFile := path.Join(TestCaseBasePath, "header", "out", "out.go")
+	expected, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := ReadManifest(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Package != "out" || len(manifest.Files) != 2 || !manifest.Options.Header {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+
+	if err := Regen(outFile); err != nil {
+		t.Fatal(err)
+	}
+	regenerated, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, regenerated) {
+		t.Errorf("regenerated file differs:\n%s\n---\n%s", expected, regenerated)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	dir := t.TempDir()
+	srcFiles := writeSources(t, dir, []string{"a_linux.go", "b_windows.go", "c.go"},
+		[]string{"package a\n\nconst A = 1\n", "package b\n\nconst B = 2\n", "package c\n\nconst C = 3\n"})
+	postfixes := []string{"A", "B", "C"}
+	outFile := path.Join(dir, "out", "out.go")
+	if err := os.Mkdir(path.Dir(outFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	options := Options{}
+	if err := Merge(srcFiles, postfixes, outFile, "out", options); err == nil {
+		t.Error("expected incompatible constraints error")
+	}
+
+	options.Constraints = pkg.ConstraintSelect
+	options.GOOS, options.GOARCH = "windows", "amd64"
+	if err := Merge(srcFiles, postfixes, outFile, "out", options); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(t, outFile, "//go:build windows\n\npackage out\n\nconst B = 2\n\nconst C = 3\n")
+
+	options.Constraints = pkg.ConstraintSplit
+	if err := Merge(srcFiles, postfixes, outFile, "out", options); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(t, path.Join(dir, "out", "out_linux_build.go"), "//go:build linux\n\npackage out\n\nconst A = 1\n")
+	expectFile(t, path.Join(dir, "out", "out_windows_build.go"), "//go:build windows\n\npackage out\n\nconst B = 2\n")
+	expectFile(t, outFile, "package out\n\nconst C = 3\n")
+}
+
+// writeSources writes the sources into the files of the directory
+func writeSources(t *testing.T, dir string, names, srcs []string) []string {
+	t.Helper()
+	files := []string{}
+	for i, name := range names {
+		file := path.Join(dir, name)
+		if err := os.WriteFile(file, []byte(srcs[i]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+func expectFile(t *testing.T, file, expected string) {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Errorf("unexpected content of %v:\n%s", file, data)
+	}
+}
+
+func TestCgo(t *testing.T) {
+	dir := t.TempDir()
+	srcFiles := writeSources(t, dir, []string{"a.go", "b.go"}, []string{
+		"package a\n\n// #include <stdlib.h>\n//\n// int twice(int x) {\n// \treturn 2 * x;\n// }\nimport \"C\"\n\nfunc Twice(x int) int { return int(C.twice(C.int(x))) }\n",
+		"package b\n\n/*\n#include <stdlib.h>\n#define LIMIT 10\n*/\nimport \"C\"\n\nimport \"fmt\"\n\nfunc Limit() string { return fmt.Sprint(C.LIMIT) }\n",
+	})
+	postfixes := []string{"A", "B"}
+	outFile := path.Join(dir, "out.go")
+
+	if err := Merge(srcFiles, postfixes, outFile, "out", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(t, outFile, "package out\n\n// #include <stdlib.h>\n//\n// int twice(int x) {\n// \treturn 2 * x;\n// }\n//\n// #define LIMIT 10\nimport \"C\"\n\n"+
+		"import \"fmt\"\n\nfunc Twice(x int) int { return int(C.twice(C.int(x))) }\n\nfunc Limit() string { return fmt.Sprint(C.LIMIT) }\n")
+
+	// the same C name with a different definition
+	writeSources(t, dir, []string{"b.go"}, []string{"package b\n\n// #define twice(x) (x + x)\nimport \"C\"\n"})
+	if err := Merge(srcFiles, postfixes, outFile, "out", Options{}); err == nil {
+		t.Error("expected conflicting C definition error")
+	}
+}
+
+func TestTypeCheck(t *testing.T) {
+	dir := t.TempDir()
+	srcFiles := writeSources(t, dir, []string{"a.go", "b.go"}, []string{
+		"package a\n\nimport \"strings\"\n\nfunc Upper(s string) string { return strings.ToUpper(s) }\n",
+		"package b\n\nfunc Lower(s string) string {\n\treturn strings.ToLower(s)\n}\n",
+	})
+	postfixes := []string{"A", "B"}
+	outFile := path.Join(dir, "out.go")
+
+	// b uses the import of a ... the merged file compiles
+	options := Options{TypeCheck: true}
+	if err := Merge(srcFiles, postfixes, outFile, "out", options); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(outFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// b alone is missing the import
+	err := Merge(srcFiles[1:], postfixes[1:], outFile, "out", options)
+	typeErr, ok := err.(pkg.ErrTypeCheck)
+	if !ok || len(typeErr.Errors) != 1 {
+		t.Fatalf("expected type check error, got %v", err)
+	}
+	if pos := typeErr.Errors[0].Pos; pos.Filename != srcFiles[1] || pos.Line != 4 {
+		t.Errorf("expected error in %v:4, got %v", srcFiles[1], pos)
+	}
+	if _, err := os.Stat(outFile); !os.IsNotExist(err) {
+		t.Error("expected no merged file")
+	}
+}
+
+func TestAPICheck(t *testing.T) {
+	dir := t.TempDir()
+	srcFiles := writeSources(t, dir, []string{"a.go", "b.go", "c.go"}, []string{
+		"package a\n\ntype Foo struct{ A int }\n\nfunc (f *Foo) Get() int { return f.A }\n\ntype I interface{ M() }\n",
+		"package b\n\ntype Foo []int\n\nfunc Len(f Foo) int { return len(f) }\n",
+		"package c\n\ntype Foo struct{ A string }\n\nfunc (f *Foo) Get() string { return f.A }\n\ntype I interface {\n\tM()\n\tN()\n}\n\nfunc New() *Foo { return nil }\n",
+	})
+	postfixes := []string{"A", "B"}
+	outFile := path.Join(dir, "out.go")
+	reportFile := path.Join(dir, "api.json")
+
+	// b's Foo gets renamed ... which is compatible
+	options := Options{APICheck: true, APIReport: reportFile}
+	if err := Merge(srcFiles[:2], postfixes, outFile, "out", options); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(t, reportFile, `{
+	"compatible": true,
+	"changes": [
+		{
+			"file": "`+srcFiles[1]+`",
+			"name": "Foo",
+			"kind": "renamed",
+			"merged": "FooB"
+		}
+	]
+}`)
+
+	// compare c with the merged file, as if it was merged
+	imp := importer.ForCompiler(token.NewFileSet(), "source", nil)
+	merged, err := pkg.TypeCheckFiles(imp, outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := pkg.TypeCheckFiles(imp, srcFiles[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := []string{}
+	for _, c := range pkg.CompareAPI(srcFiles[2], src, merged, nil) {
+		changes = append(changes, fmt.Sprintf("%v %v", c.Kind, c.Name))
+	}
+	expected := "field-changed Foo.A,type-changed Foo.Get,method-lost I.N,removed New"
+	if strings.Join(changes, ",") != expected {
+		t.Errorf("unexpected API changes: %v", changes)
+	}
+
+	// the API of a file with type errors can't be compared
+	invalid := writeSources(t, dir, []string{"d.go"}, []string{"package d\n\nvar D Undefined\n"})[0]
+	if _, err := pkg.TypeCheckFiles(imp, invalid); err == nil {
+		t.Error("expected type error")
+	}
+	if err := Merge([]string{srcFiles[0], invalid}, postfixes, outFile, "out", options); err == nil {
+		t.Error("expected API check error")
+	}
+}
+
+func TestPackages(t *testing.T) {
+	testBasePath := path.Join(TestCaseBasePath, "package")
+	expected, err := os.ReadFile(path.Join(testBasePath, "out", "out.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the package name is the default postfix
+	srcDirs := []string{path.Join(testBasePath, "a"), path.Join(testBasePath, "b")}
+	outFile := path.Join(t.TempDir(), "out.go")
+	if err := Merge(srcDirs, []string{"", ""}, outFile, "out", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(t, outFile, string(expected))
+}
+
+func TestPackageReferences(t *testing.T) {
+	testBasePath := path.Join("..", "..", "test", "packages", "refs")
+	srcDirs := []string{path.Join(testBasePath, "a"), path.Join(testBasePath, "b")}
+	outFile := path.Join(testBasePath, "out", "out.go")
+	if err := Merge(srcDirs, []string{"", ""}, outFile, "out", Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a refers to the renamed declarations of b
+	for _, expected := range []string{"func Wrap(f Foo) *FooB {\n\treturn New(int(f))", "var Default = Limit"} {
+		if !bytes.Contains(data, []byte(expected)) {
+			t.Errorf("expected %q in merged file:\n%s", expected, data)
+		}
+	}
+	if bytes.Contains(data, []byte("import")) {
+		t.Errorf("expected no import of a merged package:\n%s", data)
+	}
+}
+
+func TestPackageReferenceErrors(t *testing.T) {
+	a := pkg.Source{Name: "a.go", Src: []byte("package a\n\nimport \"example.com/b\"\n\nfunc F() int {\n\tLimit := 1\n\treturn Limit + b.Limit\n}\n"), ImportPath: "example.com/a"}
+	b := pkg.Source{Name: "b_windows.go", Src: []byte("package b\n\nconst Limit = 2\n"), ImportPath: "example.com/b", Postfix: "B"}
+	options := pkg.MergeOptions{PackageName: "out", FileName: "out.go"}
+
+	// the local variable would capture the reference
+	_, err := pkg.MergeSources(context.Background(), []pkg.Source{a, b}, options)
+	if err == nil || !strings.Contains(err.Error(), "shadowed") {
+		t.Errorf("expected shadowing error, got %v", err)
+	}
+
+	// b contributes no declarations, so b.Limit can't be resolved
+	options.Constraints, options.GOOS = pkg.ConstraintSelect, "linux"
+	_, err = pkg.MergeSources(context.Background(), []pkg.Source{a, b}, options)
+	if err == nil || !strings.Contains(err.Error(), "a.go:7:17: b.Limit") {
+		t.Errorf("expected unresolved reference error, got %v", err)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	testBasePath := path.Join("..", "..", "test", "packages", "bundle")
+	outFile := path.Join(testBasePath, "out", "out.go")
+	options := Options{Bundle: []string{"github.com/tfaller/go-srcmerge/test/packages/bundle/dep"}}
+	if err := Merge([]string{path.Join(testBasePath, "app")}, []string{""}, outFile, "out", options); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the app refers to the prefixed declarations, which refer to the bundled internal package
+	for _, expected := range []string{"store *depStore", "depNew(depDefaultSize)", "func depNew(size int) *depStore", "deputilGrow(size)", "func deputilGrow(",
+		// locals, fields and methods keep their names
+		"func (s *depStore) Stats() depStats {\n\tNew := len(s.keys)\n\treturn depStats{DefaultSize: depDefaultSize + New}"} {
+		if !bytes.Contains(data, []byte(expected)) {
+			t.Errorf("expected %q in merged file:\n%s", expected, data)
+		}
+	}
+	if bytes.Contains(data, []byte("import")) {
+		t.Errorf("expected no import of a bundled package:\n%s", data)
+	}
+
+	// each bundle gets its own prefix, an internal package is bundled only once
+	dep := "github.com/tfaller/go-srcmerge/test/packages/bundle/dep"
+	for _, test := range []struct {
+		bundles  []string
+		prefixes string
+	}{
+		{[]string{dep, dep + "/internal/util"}, "xDeputil,xDep"},
+		{[]string{dep + "/internal/util", dep}, "xUtil,xDep"},
+	} {
+		inputs, err := resolveBundles(Options{Bundle: test.bundles, BundlePrefix: "x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefixes := []string{}
+		for _, input := range inputs {
+			prefixes = append(prefixes, input.Prefix)
+		}
+		if strings.Join(prefixes, ",") != test.prefixes {
+			t.Errorf("%v: unexpected prefixes %v", test.bundles, prefixes)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	outFile := path.Join(t.TempDir(), "options.go")
+	if err := Extract([]string{"defaultOptions"}, path.Join(TestCaseBasePath, "tree-shaking"), outFile, "", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	// side effects of the package are not extracted
+	expectFile(t, outFile, "package shake\n\ntype options struct {\n\tretries int\n}\n\n"+
+		"func defaultOptions() options {\n\treturn options{retries: retries}\n}\n\n"+
+		"const (\n\tretries = iota + 3\n\ttimeout\n)\n")
+}
+
+// provenanceFiles are the source files of the provenance test case
+func provenanceFiles() []string {
+	return []string{path.Join(TestCaseBasePath, "provenance", "0", "0.go"), path.Join(TestCaseBasePath, "provenance", "1", "1.go")}
+}
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+	merged := path.Join(TestCaseBasePath, "provenance", "out", "out.go")
+	if err := Split(merged, dir, pkg.SplitOrigin, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// merging the split files again must result in the same file
+	outFile := path.Join(dir, "out", "out.go")
+	if err := os.MkdirAll(path.Dir(outFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{path.Join(dir, "0", "0.go"), path.Join(dir, "1", "1.go")}
+	options := Options{Options: pkg.Options{Provenance: true}}
+	if err := Merge(files, []string{"0", "1"}, outFile, "out", options); err != nil {
+		t.Fatal(err)
+	}
+	// the positions of the provenance differ, but splitting again must be stable
+	expected, err := os.ReadFile(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remerged, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := pkg.Split(expected, merged, pkg.SplitOrigin, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := pkg.Split(remerged, outFile, pkg.SplitOrigin, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("split of the merged split files differs:\n%s\n%s", second[0].Src, second[1].Src)
+	}
+	expectFile(t, files[1], "// Copyright 2022 The Authors. All rights reserved.\n\n"+
+		"// Package provenance tests the origin annotations of merged declarations.\n//\n// Package provenance is documented in both files.\npackage out\n\n"+
+		"import \"strings\"\n\n"+
+		"// Config configures a service.\ntype Config struct {\n\t// Name of the service\n\tName string\n"+
+		"\t// Port of the service\n\tPort int `json:\"port\"` // 0 picks a free port\n}\n\n"+
+		"var (\n\t// Default is in both files\n\tDefault = Config{Name: \"default\"}\n)\n\n"+
+		"// Describe describes a config.\nfunc Describe(c Config) string {\n\treturn strings.ToUpper(c.Name)\n}\n\n"+
+		"// Level is the name of a log level.\ntype Level string\n\n"+
+		"// Levels by their name.\nconst (\n\tLow  Level = \"low\"\n\tHigh Level = \"high\"\n)\n\n"+
+		"var (\n\t// Fallback is only in this file\n\tFallback = Default\n)\n\n"+
+		"func init() {\n\tFallback.Port = 8080\n}\n")
+
+	for _, test := range []struct {
+		strategy pkg.SplitStrategy
+		max      int
+		files    []string
+	}{
+		{pkg.SplitType, 0, []string{"config.go", "level.go", "out.go", "level1.go"}},
+		{pkg.SplitMax, 2, []string{"out_1.go", "out_2.go", "out_3.go", "out_4.go", "out_5.go"}},
+	} {
+		files, err := pkg.Split(expected, merged, test.strategy, test.max, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, file := range files {
+			names = append(names, file.Name)
+		}
+		if !reflect.DeepEqual(names, test.files) {
+			t.Errorf("%v: expected files %v, got %v", test.strategy, test.files, names)
+		}
+	}
+}
+
+func TestSplitCases(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		sources  []string
+		strategy pkg.SplitStrategy
+		// expected content of the split files, a leading "!" must not be contained
+		expected map[string][]string
+	}{
+		{
+			name: "duplicate with fewer fields",
+			sources: []string{
+				"package a\n\ntype S struct {\n\tA int\n}\n",
+				"package b\n\ntype S struct {\n\tA int\n\tB int\n}\n",
+				"package c\n\ntype S struct {\n\tA int\n}\n",
+			},
+			strategy: pkg.SplitOrigin,
+			expected: map[string][]string{
+				"a.go": {"type S struct {\n\tA int\n}\n"},
+				"b.go": {"type S struct {\n\tA int\n\tB int\n}\n"},
+				"c.go": {"type S struct {\n\tA int\n}\n"},
+			},
+		},
+		{
+			name: "restored names",
+			sources: []string{
+				"package a\n\ntype Mode int\n\nfunc F() {\n\tMode2 := 1\n\t_ = Mode2\n}\n",
+				"package b\n\ntype Mode string\n\ntype T struct{ Mode2 Mode }\n\nvar V = T{Mode2: Mode(\"b\")}\n",
+			},
+			strategy: pkg.SplitOrigin,
+			expected: map[string][]string{
+				"a.go": {"\tMode2 := 1\n\t_ = Mode2\n"},
+				"b.go": {"type Mode string\n", "type T struct{ Mode2 Mode }\n", "var V = T{Mode2: Mode(\"b\")}\n"},
+			},
+		},
+		{
+			name: "annotations in strings",
+			sources: []string{
+				"package a\n\nvar Doc = `\n//srcmerge:origin Doc a.go:1\n//line a.go:1\n`\n",
+			},
+			strategy: pkg.SplitOrigin,
+			expected: map[string][]string{
+				"a.go": {"var Doc = `\n//srcmerge:origin Doc a.go:1\n//line a.go:1\n`\n", "!// Code generated"},
+			},
+		},
+		{
+			name: "init functions",
+			sources: []string{
+				"package a\n\nvar A int\n\nfunc init() {\n\tA = 1\n}\n",
+				"package b\n\nfunc init() {}\n\nvar _ = A\n",
+			},
+			strategy: pkg.SplitOrigin,
+			expected: map[string][]string{
+				"a.go": {"func init() {\n\tA = 1\n}\n", "!func init() {}"},
+				"b.go": {"func init() {}\n", "var _ = A\n"},
+			},
+		},
+		{
+			name: "blanked iota constants",
+			sources: []string{
+				"package a\n\nconst (\n\tA = iota\n\tB\n)\n",
+				"package b\n\nconst (\n\tA = iota\n\tC\n)\n",
+			},
+			strategy: pkg.SplitOrigin,
+			expected: map[string][]string{
+				"a.go": {"\tA = iota\n\tB\n"},
+				"b.go": {"\t_ = iota\n\tC\n"},
+			},
+		},
+		{
+			name: "type name collisions",
+			sources: []string{
+				"package a\n\ntype Foo int\n\ntype foo int\n\ntype out int\n\nvar V = 1\n",
+			},
+			strategy: pkg.SplitType,
+			expected: map[string][]string{
+				"foo.go":   {"type Foo int\n"},
+				"foo_2.go": {"type foo int\n"},
+				"out_2.go": {"type out int\n"},
+				"out.go":   {"var V = 1\n"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sources := []pkg.Source{}
+			for i, src := range test.sources {
+				name := string(rune('a'+i)) + ".go"
+				sources = append(sources, pkg.Source{Name: name, Src: []byte(src), Postfix: fmt.Sprint(i + 1)})
+			}
+			options := pkg.MergeOptions{Options: pkg.Options{Provenance: true}, PackageName: "out", FileName: "out.go", Header: GeneratedHeader}
+			result, err := pkg.MergeSources(context.Background(), sources, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, err := pkg.Split(result.Src, "out.go", test.strategy, 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(test.expected) {
+				t.Errorf("expected %v files, got %v", len(test.expected), len(files))
+			}
+			for _, file := range files {
+				for _, expected := range test.expected[file.Name] {
+					if unexpected := strings.TrimPrefix(expected, "!"); unexpected != expected {
+						if strings.Contains(string(file.Src), unexpected) {
+							t.Errorf("unexpected %q in %v:\n%s", unexpected, file.Name, file.Src)
+						}
+					} else if !strings.Contains(string(file.Src), expected) {
+						t.Errorf("expected %q in %v:\n%s", expected, file.Name, file.Src)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFiles(t *testing.T) {
+	outDir := path.Join(t.TempDir(), "out")
+	files := provenanceFiles()
+	options := Options{Header: true, Files: pkg.SplitOrigin}
+	if err := Merge(files, []string{"0", "1"}, outDir, "out", options); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{pkg.CommonFile, "0.go", "1.go"}
+	outFiles := []string{}
+	for _, name := range names {
+		outFiles = append(outFiles, path.Join(outDir, name))
+	}
+	// renames apply to all files of the package
+	fset := token.NewFileSet()
+	astFiles := []*ast.File{}
+	for _, file := range outFiles {
+		astFile, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		astFiles = append(astFiles, astFile)
+	}
+	typeErrors := []error{}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil), Error: func(err error) { typeErrors = append(typeErrors, err) }}
+	if _, err := conf.Check("out", fset, astFiles, nil); err != nil || len(typeErrors) > 0 {
+		t.Fatalf("the files of the package don't type check: %v", typeErrors)
+	}
+	src, err := os.ReadFile(outFiles[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), "type Level1 string") || strings.Contains(string(src), "srcmerge:origin") {
+		t.Errorf("unexpected content of %v:\n%s", outFiles[2], src)
+	}
+	if strings.Contains(string(src), "Package provenance") {
+		t.Errorf("package documentation must only be in %v", pkg.CommonFile)
+	}
+	// every file keeps its own init function
+	if !strings.Contains(string(src), "func init() {\n\tFallback.Port = 8080\n}") || strings.Count(string(src), "func init()") != 1 {
+		t.Errorf("expected the init function of 1.go in %v:\n%s", outFiles[2], src)
+	}
+
+	// the manifest of the directory regenerates all files, stale
+	// generated files are removed, but other files are kept
+	stale, kept := path.Join(outDir, "stale.go"), path.Join(outDir, "kept.go")
+	if err := os.Rename(outFiles[0], stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(kept, []byte("package out\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Regen(outDir); err != nil {
+		t.Fatal(err)
+	}
+	if src, err = os.ReadFile(outFiles[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), "Port int") {
+		t.Errorf("unexpected content of %v:\n%s", outFiles[0], src)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected %v to be removed", stale)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("expected %v to be kept: %v", kept, err)
+	}
+}
+
+func TestLoadAstFile(t *testing.T) {
+	srcFiles := writeSources(t, t.TempDir(), []string{"0.go", "1.go"}, []string{
+		"package a\n\nvar (\n\t// A is in both files\n\tA = 1\n\tB = 2\n)\n",
+		"package b\n\nvar (\n\t// A is in both files\n\tA = 1\n\tC = 3\n)\n",
+	})
+	m := pkg.NewMerger("out")
+	for i, file := range srcFiles {
+		astFile, err := pkg.LoadAstFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Merge(astFile, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src, err := m.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "package out\n\nvar (\n\t// A is in both files\n\tA = 1\n\tB = 2\n)\n\nvar (\n\tC = 3\n)\n"
+	if string(src) != expected {
+		t.Errorf("unexpected merged file:\n%s", src)
+	}
+	// positions of another file set are ignored instead of panicking
+	other, err := parser.ParseFile(token.NewFileSet(), "c.go", "package c\n\nvar (\n\tA = 1\n\tD = 4\n)\n", parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Merge(other, "2"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeSources(t *testing.T) {
+	sources := []pkg.Source{
+		{Name: "a.go", Src: []byte("package a\n\ntype Foo int\n\nfunc Hello() {}\n"), Postfix: "A"},
+		{Name: "b.go", Reader: strings.NewReader("package b\n\ntype Foo string\n\nfunc Hello() {}\n"), Postfix: "B"},
+	}
+	options := pkg.MergeOptions{PackageName: "out", FileName: "out.go", TypeCheck: true}
+	result, err := pkg.MergeSources(context.Background(), sources, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "package out\n\ntype Foo int\n\nfunc Hello() {}\n\ntype FooB string\n"
+	if string(result.Src) != expected {
+		t.Errorf("unexpected merged file:\n%s", result.Src)
+	}
+	if result.File.Name.Name != "out" || len(result.File.Decls) != 3 || result.Package == nil {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if origin := result.Report.Origins[2]; origin.Name != "FooB" || origin.Original != "Foo" || origin.Pos.Filename != "b.go" {
+		t.Errorf("unexpected origin %+v", origin)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pkg.MergeSources(ctx, sources, options); err != context.Canceled {
+		t.Errorf("expected the context error, got %v", err)
+	}
+
+	// the files of one package are only merged together on request
+	sources[1] = pkg.Source{Name: "b.go", Src: []byte("package b\n\ntype Foo string\n"), Postfix: "B"}
+	sources = append(sources, pkg.Source{Name: "b2.go", Src: []byte("package b\n\nfunc World() Foo { return Foo(\"\") }\n"), Postfix: "B", SamePackage: true})
+	if result, err = pkg.MergeSources(context.Background(), sources, options); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(result.Src), "func World() FooB {") {
+		t.Errorf("expected the renames of the package in all its files:\n%s", result.Src)
+	}
+	sources[2].Postfix = "C"
+	if _, err := pkg.MergeSources(context.Background(), sources, options); err == nil {
+		t.Errorf("expected an error for a different postfix of the same package")
+	}
+	if _, err := pkg.MergeSources(context.Background(), sources[2:], options); err == nil {
+		t.Errorf("expected an error for a missing previous source")
+	}
+}
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	reportFile := path.Join(dir, "report.json")
+	files := provenanceFiles()
+	options := Options{Report: reportFile, Keep: []string{"Describe", "Level1"}}
+	if err := Merge(files, []string{"0", "1"}, path.Join(dir, "out.go"), "out", options); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := pkg.Report{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	expectDecisions(t, report.Decisions, []string{
+		"import strings kept",
+		"type Config kept",
+		"type Level kept",
+		"const Debug kept",
+		"const Info kept",
+		"var Default kept",
+		"var Prefix kept",
+		"func Describe kept",
+		"func init kept",
+		"import strings deduped",
+		"type Config fields-merged",
+		"type Level renamed Level1",
+		"const Low kept",
+		"const High kept",
+		"var Default deduped",
+		"var Fallback kept",
+		"func Describe deduped",
+		"func init kept",
+		"type Level removed",
+		"const Debug removed",
+		"const Info removed",
+		"const Low removed",
+		"const High removed",
+	})
+
+	// every import gets a decision
+	sources := []pkg.Source{
+		{Name: "a.go", Src: []byte("package a\n\n// int one() { return 1; }\nimport \"C\"\n\nimport (\n\t_ \"embed\"\n\t. \"strings\"\n\n\t\"example.com/b\"\n\t\"old.com/x\"\n)\n\nvar A = C.one() + b.B + x.X + len(Title(\"\"))\n"), Postfix: "A"},
+		{Name: "b.go", Src: []byte("package b\n\nimport (\n\t_ \"embed\"\n\t. \"strings\"\n)\n\nvar B = len(ToLower(\"\"))\n"), Postfix: "B", ImportPath: "example.com/b"},
+	}
+	rewrites := []pkg.ImportRewrite{{Old: "old.com/x", New: "new.com/x"}}
+	result, err := pkg.MergeSources(context.Background(), sources, pkg.MergeOptions{Options: pkg.Options{ImportRewrites: rewrites}, PackageName: "out"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectDecisions(t, result.Report.Decisions, []string{
+		"import C kept",
+		"import _ kept",
+		"import . kept",
+		"import b import-merged",
+		"import x kept old.com/x -> new.com/x",
+		"var A kept",
+		"import _ deduped",
+		"import . deduped",
+		"var B kept",
+	})
+
+	// the events are logged by their level, see -q and -v
+	for _, test := range []struct {
+		level pkg.Level
+		lines int
+	}{
+		{pkg.LevelWarn, 0},
+		{pkg.LevelInfo, 2},
+		{pkg.LevelDebug, 5},
+	} {
+		out := &bytes.Buffer{}
+		options := Options{Events: pkg.LogHandler{Logger: log.New(out, "", 0), Level: test.level}}
+		if err := Merge(files, []string{"0", "1"}, path.Join(dir, "out.go"), "out", options); err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(out.String(), "\n"); lines != test.lines {
+			t.Errorf("%v: expected %v log lines, got:\n%s", test.level, test.lines, out)
+		}
+	}
+}
+
+// expectDecisions compares the decisions as "kind name outcome [new name] [path -> new path]"
+func expectDecisions(t *testing.T, decisions []pkg.Decision, expected []string) {
+	t.Helper()
+	outcomes := []string{}
+	for _, d := range decisions {
+		outcome := fmt.Sprintf("%v %v %v", d.Kind, d.Name, d.Outcome)
+		if d.NewName != "" {
+			outcome += " " + d.NewName
+		}
+		if d.NewPath != "" {
+			outcome += fmt.Sprintf(" %v -> %v", d.Path, d.NewPath)
+		}
+		switch d.Outcome {
+		case pkg.OutcomeRenamed, pkg.OutcomeFieldsMerged:
+			if d.Mismatch == "" {
+				t.Errorf("%v: missing mismatch", outcome)
+			}
+			fallthrough
+		case pkg.OutcomeDeduped:
+			if d.Existing == nil && d.Kind != "import" {
+				t.Errorf("%v: missing existing declaration", outcome)
+			}
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	if !reflect.DeepEqual(outcomes, expected) {
+		t.Errorf("unexpected decisions:\n%v", strings.Join(outcomes, "\n"))
+	}
+}
+
+// eventRecorder records the events of a merge
+type eventRecorder struct {
+	level  pkg.Level
+	events []pkg.Event
+}
+
+func (r *eventRecorder) Enabled(level pkg.Level) bool {
+	return level >= r.level
+}
+
+func (r *eventRecorder) Handle(event pkg.Event) {
+	r.events = append(r.events, event)
+}
+
+func TestEvents(t *testing.T) {
+	sources := []pkg.Source{
+		{Name: "a.go", Src: []byte("package a\n\nimport \"math/rand\"\n\ntype S struct{ A int }\n\nvar R = rand.Int\n\nfunc Hello() {}\n"), Postfix: "A"},
+		{Name: "b.go", Src: []byte("package b\n\nimport rand \"crypto/rand\"\n\ntype S struct{ A, B int }\n\nvar R = rand.Read\n\nfunc Hello() {}\n"), Postfix: "B"},
+	}
+	recorder := &eventRecorder{level: pkg.LevelDebug}
+	if _, err := pkg.MergeSources(context.Background(), sources, pkg.MergeOptions{PackageName: "out", Events: recorder}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []pkg.Event{
+		pkg.ImportConflict{Name: "rand", Path: "crypto/rand", ExistingPath: "math/rand", NewName: "randB"},
+		pkg.FieldsMerged{Struct: "S", Fields: []string{"B"}},
+		pkg.Dedup{Name: "S"},
+		pkg.Rename{Name: "R", NewName: "RB", Mismatch: "values not equal: expr 0 not equal: selector name not equal: \"Int\" != \"Read\""},
+		pkg.Dedup{Name: "Hello"},
+	}
+	if !reflect.DeepEqual(recorder.events, expected) {
+		t.Errorf("unexpected events %#v", recorder.events)
+	}
+
+	// the debug events are not handled
+	recorder = &eventRecorder{level: pkg.LevelInfo}
+	if _, err := pkg.MergeSources(context.Background(), sources, pkg.MergeOptions{PackageName: "out", Events: recorder}); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.events) != 3 {
+		t.Errorf("expected only the info events, got %v", recorder.events)
+	}
+
+	// only the command line tool logs the events
+	if events := pkg.NewMerger("out").Events; events != nil {
+		t.Errorf("expected no event handler by default, got %v", events)
+	}
+}
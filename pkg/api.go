@@ -0,0 +1,390 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// APIChangeKind describes how an exported identifier changed.
+type APIChangeKind string
+
+const (
+	// APIRenamed identifier was renamed because of a name conflict
+	APIRenamed APIChangeKind = "renamed"
+	// APIRemoved identifier doesn't exist in the merged file
+	APIRemoved APIChangeKind = "removed"
+	// APITypeChanged identifier has a different type or signature
+	APITypeChanged APIChangeKind = "type-changed"
+	// APIFieldChanged struct field was removed or has a different type
+	APIFieldChanged APIChangeKind = "field-changed"
+	// APIMethodLost interface lost a method or the method has a different signature
+	APIMethodLost APIChangeKind = "method-lost"
+)
+
+// APIChange is a difference between the exported API of
+// a source file and the merged file.
+type APIChange struct {
+	File string        `json:"file"`
+	Name string        `json:"name"`
+	Kind APIChangeKind `json:"kind"`
+	// Merged is the name in the merged file
+	Merged string `json:"merged,omitempty"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+// Compatible checks whether the change keeps the API,
+// which is only the case for explicit renames.
+func (c APIChange) Compatible() bool {
+	return c.Kind == APIRenamed
+}
+
+func (c APIChange) String() string {
+	switch c.Kind {
+	case APIRenamed:
+		return fmt.Sprintf("%v: %v renamed to %v", c.File, c.Name, c.Merged)
+	case APIRemoved:
+		return fmt.Sprintf("%v: %v removed", c.File, c.Name)
+	}
+	return fmt.Sprintf("%v: %v %v: %v -> %v", c.File, c.Name, c.Kind, c.Old, c.New)
+}
+
+// APIReport lists all API changes of a merge.
+type APIReport struct {
+	Compatible bool        `json:"compatible"`
+	Changes    []APIChange `json:"changes"`
+}
+
+// ErrAPIChanged is returned if the merged file doesn't
+// provide the API of all source files.
+type ErrAPIChanged struct {
+	Changes []APIChange
+}
+
+func (e ErrAPIChanged) Error() string {
+	msgs := make([]string, len(e.Changes))
+	for i, c := range e.Changes {
+		msgs[i] = c.String()
+	}
+	return "merged file changes the API:\n" + strings.Join(msgs, "\n")
+}
+
+// NewAPIReport creates the report of the given changes.
+func NewAPIReport(changes []APIChange) APIReport {
+	report := APIReport{Compatible: true, Changes: changes}
+	for _, c := range changes {
+		report.Compatible = report.Compatible && c.Compatible()
+	}
+	return report
+}
+
+// Err returns an ErrAPIChanged with all incompatible changes, if there are any.
+func (r APIReport) Err() error {
+	incompatible := []APIChange{}
+	for _, c := range r.Changes {
+		if !c.Compatible() {
+			incompatible = append(incompatible, c)
+		}
+	}
+	if len(incompatible) == 0 {
+		return nil
+	}
+	return ErrAPIChanged{Changes: incompatible}
+}
+
+// TypeCheckFiles type checks the source files of a package as a whole.
+// It returns the first type error, the API of a package with type
+// errors can't be compared.
+func TypeCheckFiles(importer types.Importer, fileNames ...string) (*types.Package, error) {
+	fset := token.NewFileSet()
+	files := make([]*ast.File, len(fileNames))
+	for i, fileName := range fileNames {
+		file, err := parser.ParseFile(fset, fileName, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = file
+	}
+	conf := types.Config{Importer: importer, FakeImportC: true}
+	return conf.Check(files[0].Name.Name, fset, files, nil)
+}
+
+// Renames returns the renamed declarations of a source file.
+// It maps the original name to the name in the merged file.
+func (m *Merger) Renames(fileName string) map[string]string {
+	renames := map[string]string{}
+	for _, name := range m.originNames {
+		origin := m.origins[name]
+		if origin.Original != "" && origin.Pos.Filename == fileName && !strings.Contains(name, ".") {
+			renames[origin.Original] = name
+		}
+	}
+	return renames
+}
+
+// CompareAPI compares the exported API of a source package with the merged
+// package. renames maps names of the source package to the merged package.
+func CompareAPI(fileName string, src, merged *types.Package, renames map[string]string) []APIChange {
+	c := apiComparer{file: fileName, src: src, merged: merged, renames: renames}
+
+	changes := []APIChange{}
+	scope := src.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		mergedName := name
+		if renamed, ok := renames[name]; ok {
+			mergedName = renamed
+			changes = append(changes, APIChange{File: fileName, Name: name, Kind: APIRenamed, Merged: renamed})
+		}
+		mergedObj := merged.Scope().Lookup(mergedName)
+		if mergedObj == nil {
+			changes = append(changes, APIChange{File: fileName, Name: name, Kind: APIRemoved})
+			continue
+		}
+		changes = append(changes, c.compareObject(name, mergedName, obj, mergedObj)...)
+	}
+	return changes
+}
+
+type apiComparer struct {
+	file        string
+	src, merged *types.Package
+	renames     map[string]string
+}
+
+// srcType formats a type of the source package
+func (c apiComparer) srcType(t types.Type) string {
+	return types.TypeString(t, qualifier(c.src))
+}
+
+// mergedType formats a type of the merged package
+func (c apiComparer) mergedType(t types.Type) string {
+	return types.TypeString(t, qualifier(c.merged))
+}
+
+// sameType compares a type of the source package with a type of the merged
+// package. Named types of the source package must have their merged name,
+// named types of other packages must be the same.
+func (c apiComparer) sameType(src, merged types.Type) bool {
+	switch s := src.(type) {
+	case *types.Basic:
+		m, ok := merged.(*types.Basic)
+		return ok && s.Kind() == m.Kind()
+	case *types.Named:
+		m, ok := merged.(*types.Named)
+		if !ok || !c.sameTypeName(s.Obj(), m.Obj()) || s.TypeArgs().Len() != m.TypeArgs().Len() {
+			return false
+		}
+		for i := 0; i < s.TypeArgs().Len(); i++ {
+			if !c.sameType(s.TypeArgs().At(i), m.TypeArgs().At(i)) {
+				return false
+			}
+		}
+		return true
+	case *types.TypeParam:
+		m, ok := merged.(*types.TypeParam)
+		return ok && s.Index() == m.Index()
+	case *types.Pointer:
+		m, ok := merged.(*types.Pointer)
+		return ok && c.sameType(s.Elem(), m.Elem())
+	case *types.Slice:
+		m, ok := merged.(*types.Slice)
+		return ok && c.sameType(s.Elem(), m.Elem())
+	case *types.Array:
+		m, ok := merged.(*types.Array)
+		return ok && s.Len() == m.Len() && c.sameType(s.Elem(), m.Elem())
+	case *types.Map:
+		m, ok := merged.(*types.Map)
+		return ok && c.sameType(s.Key(), m.Key()) && c.sameType(s.Elem(), m.Elem())
+	case *types.Chan:
+		m, ok := merged.(*types.Chan)
+		return ok && s.Dir() == m.Dir() && c.sameType(s.Elem(), m.Elem())
+	case *types.Signature:
+		m, ok := merged.(*types.Signature)
+		return ok && s.Variadic() == m.Variadic() && c.sameType(s.Params(), m.Params()) && c.sameType(s.Results(), m.Results())
+	case *types.Tuple:
+		m, ok := merged.(*types.Tuple)
+		if !ok || s.Len() != m.Len() {
+			return false
+		}
+		for i := 0; i < s.Len(); i++ {
+			if !c.sameType(s.At(i).Type(), m.At(i).Type()) {
+				return false
+			}
+		}
+		return true
+	case *types.Struct:
+		m, ok := merged.(*types.Struct)
+		if !ok || s.NumFields() != m.NumFields() {
+			return false
+		}
+		for i := 0; i < s.NumFields(); i++ {
+			sf, mf := s.Field(i), m.Field(i)
+			if sf.Name() != mf.Name() || sf.Embedded() != mf.Embedded() || s.Tag(i) != m.Tag(i) || !c.sameType(sf.Type(), mf.Type()) {
+				return false
+			}
+		}
+		return true
+	case *types.Interface:
+		m, ok := merged.(*types.Interface)
+		if !ok || s.NumMethods() != m.NumMethods() || s.NumEmbeddeds() != m.NumEmbeddeds() {
+			return false
+		}
+		for i := 0; i < s.NumMethods(); i++ {
+			sm, mm := s.Method(i), m.Method(i)
+			if sm.Name() != mm.Name() || !c.sameType(sm.Type(), mm.Type()) {
+				return false
+			}
+		}
+		for i := 0; i < s.NumEmbeddeds(); i++ {
+			if !c.sameType(s.EmbeddedType(i), m.EmbeddedType(i)) {
+				return false
+			}
+		}
+		return true
+	case *types.Union:
+		m, ok := merged.(*types.Union)
+		if !ok || s.Len() != m.Len() {
+			return false
+		}
+		for i := 0; i < s.Len(); i++ {
+			if s.Term(i).Tilde() != m.Term(i).Tilde() || !c.sameType(s.Term(i).Type(), m.Term(i).Type()) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// sameTypeName compares a named type of the source package with one of the merged package
+func (c apiComparer) sameTypeName(src, merged *types.TypeName) bool {
+	switch {
+	case src.Pkg() == nil:
+		// predeclared, e.g. error
+		return merged.Pkg() == nil && src.Name() == merged.Name()
+	case src.Pkg() == c.src:
+		name := src.Name()
+		if renamed, ok := c.renames[name]; ok {
+			name = renamed
+		}
+		return merged.Pkg() == c.merged && merged.Name() == name
+	}
+	return merged.Pkg() != nil && src.Pkg().Path() == merged.Pkg().Path() && src.Name() == merged.Name()
+}
+
+func qualifier(pkg *types.Package) types.Qualifier {
+	return func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		return other.Path()
+	}
+}
+
+func (c apiComparer) change(name string, kind APIChangeKind, old, new string) APIChange {
+	return APIChange{File: c.file, Name: name, Kind: kind, Old: old, New: new}
+}
+
+func (c apiComparer) compareObject(name, mergedName string, obj, mergedObj types.Object) []APIChange {
+	srcTypeName, isType := obj.(*types.TypeName)
+	mergedTypeName, mergedIsType := mergedObj.(*types.TypeName)
+	if !isType || !mergedIsType {
+		if isType != mergedIsType || !c.sameType(obj.Type(), mergedObj.Type()) {
+			return []APIChange{c.change(name, APITypeChanged, c.srcType(obj.Type()), c.mergedType(mergedObj.Type()))}
+		}
+		return nil
+	}
+
+	changes := []APIChange{}
+	srcUnder, mergedUnder := srcTypeName.Type().Underlying(), mergedTypeName.Type().Underlying()
+	srcStruct, isStruct := srcUnder.(*types.Struct)
+	mergedStruct, mergedIsStruct := mergedUnder.(*types.Struct)
+	srcIface, isIface := srcUnder.(*types.Interface)
+	mergedIface, mergedIsIface := mergedUnder.(*types.Interface)
+	switch {
+	case isStruct && mergedIsStruct:
+		changes = append(changes, c.compareFields(name, srcStruct, mergedStruct)...)
+	case isIface && mergedIsIface:
+		changes = append(changes, c.compareInterface(name, srcIface, mergedIface)...)
+	default:
+		if !c.sameType(srcUnder, mergedUnder) {
+			changes = append(changes, c.change(name, APITypeChanged, c.srcType(srcUnder), c.mergedType(mergedUnder)))
+		}
+	}
+	return append(changes, c.compareMethods(name, srcTypeName.Type(), mergedTypeName.Type())...)
+}
+
+func (c apiComparer) compareFields(name string, src, merged *types.Struct) []APIChange {
+	changes := []APIChange{}
+	mergedFields := map[string]*types.Var{}
+	for i := 0; i < merged.NumFields(); i++ {
+		mergedFields[merged.Field(i).Name()] = merged.Field(i)
+	}
+	for i := 0; i < src.NumFields(); i++ {
+		field := src.Field(i)
+		if !field.Exported() {
+			continue
+		}
+		fieldName := name + "." + field.Name()
+		old := c.srcType(field.Type())
+		mergedField := mergedFields[field.Name()]
+		if mergedField == nil {
+			changes = append(changes, c.change(fieldName, APIFieldChanged, old, ""))
+		} else if !c.sameType(field.Type(), mergedField.Type()) {
+			changes = append(changes, c.change(fieldName, APIFieldChanged, old, c.mergedType(mergedField.Type())))
+		}
+	}
+	return changes
+}
+
+func (c apiComparer) compareInterface(name string, src, merged *types.Interface) []APIChange {
+	changes := []APIChange{}
+	for i := 0; i < src.NumMethods(); i++ {
+		method := src.Method(i)
+		if !method.Exported() {
+			continue
+		}
+		methodName := name + "." + method.Name()
+		old := c.srcType(method.Type())
+		obj, _, _ := types.LookupFieldOrMethod(merged, false, c.merged, method.Name())
+		if mergedMethod, ok := obj.(*types.Func); !ok {
+			changes = append(changes, c.change(methodName, APIMethodLost, old, ""))
+		} else if !c.sameType(method.Type(), mergedMethod.Type()) {
+			changes = append(changes, c.change(methodName, APIMethodLost, old, c.mergedType(mergedMethod.Type())))
+		}
+	}
+	return changes
+}
+
+// compareMethods compares the exported methods of named types
+func (c apiComparer) compareMethods(name string, src, merged types.Type) []APIChange {
+	changes := []APIChange{}
+	if _, ok := src.Underlying().(*types.Interface); ok {
+		return changes
+	}
+	srcMethods := types.NewMethodSet(types.NewPointer(src))
+	mergedMethods := types.NewMethodSet(types.NewPointer(merged))
+	for i := 0; i < srcMethods.Len(); i++ {
+		method := srcMethods.At(i).Obj()
+		if !method.Exported() {
+			continue
+		}
+		methodName := name + "." + method.Name()
+		old := c.srcType(method.Type())
+		mergedMethod := mergedMethods.Lookup(c.merged, method.Name())
+		if mergedMethod == nil {
+			changes = append(changes, APIChange{File: c.file, Name: methodName, Kind: APIRemoved})
+		} else if !c.sameType(method.Type(), mergedMethod.Obj().Type()) {
+			changes = append(changes, c.change(methodName, APITypeChanged, old, c.mergedType(mergedMethod.Obj().Type())))
+		}
+	}
+	return changes
+}
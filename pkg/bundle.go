@@ -0,0 +1,30 @@
+package pkg
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// prefixDeclarations adds the prefix to all package level declarations
+// of a file. Only the identifiers of the package level objects are renamed.
+// It returns a map of the new names to the original names.
+func prefixDeclarations(fset *token.FileSet, file *ast.File, prefix string) map[string]string {
+	originals := map[string]string{}
+	idents := packageIdents(fset, file)
+	for _, declare := range findDeclarations(file) {
+		name := declare.name
+		if name == "init" || name == "_" || strings.Contains(name, ".") {
+			// methods keep their name, only their receiver gets renamed
+			continue
+		}
+		newName := prefix + name
+		for _, ident := range idents[name] {
+			ident.Name = newName
+		}
+		renameDocs(file, name, newName)
+		renameLinknames(file, name, newName)
+		originals[newName] = name
+	}
+	return originals
+}
@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// cgoPreamble collects the preambles of all `import "C"` declarations.
+type cgoPreamble struct {
+	used   bool
+	chunks []string
+	// defined maps a C name to the chunk which defines it
+	defined map[string]string
+	// origin maps a C name to the file which defined it first
+	origin map[string]string
+}
+
+func newCgoPreamble() *cgoPreamble {
+	return &cgoPreamble{defined: map[string]string{}, origin: map[string]string{}}
+}
+
+var (
+	cDefine   = regexp.MustCompile(`^#\s*define\s+(\w+)`)
+	cTypedef  = regexp.MustCompile(`^typedef\b[\s\S]*?(\w+)\s*(\[[^\]]*\])?\s*;\s*$`)
+	cTagged   = regexp.MustCompile(`^(struct|union|enum)\s+(\w+)\s*\{`)
+	cFunction = regexp.MustCompile(`^[\w\s\*]*?(\w+)\s*\([^;{]*\)\s*\{`)
+	cVariable = regexp.MustCompile(`^[\w\s\*]*?(\w+)\s*(\[[^\]]*\])?\s*(=[\s\S]*)?;\s*$`)
+)
+
+// cgoPreambleOf returns the preamble of an `import "C"` declaration.
+func cgoPreambleOf(file *ast.File) (*ast.CommentGroup, bool) {
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			impSpec := spec.(*ast.ImportSpec)
+			if impSpec.Path.Value != `"C"` {
+				continue
+			}
+			if impSpec.Doc != nil {
+				return impSpec.Doc, true
+			}
+			if len(genDecl.Specs) == 1 {
+				return genDecl.Doc, true
+			}
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// add adds a preamble. Chunks which are already part of the preamble are
+// ignored, a different definition of an already defined C name is an error.
+func (p *cgoPreamble) add(fileName string, preamble *ast.CommentGroup) error {
+	if preamble == nil {
+		return nil
+	}
+	for _, chunk := range cChunks(preamble.Text()) {
+		if contains(p.chunks, chunk) {
+			continue
+		}
+		name := cDefinedName(chunk)
+		if name != "" {
+			if defined, exists := p.defined[name]; exists {
+				return fmt.Errorf("%v: conflicting C definition of %q, already defined in %v:\n%v\n---\n%v",
+					fileName, name, p.origin[name], defined, chunk)
+			}
+			p.defined[name] = chunk
+			p.origin[name] = fileName
+		}
+		p.chunks = append(p.chunks, chunk)
+	}
+	return nil
+}
+
+// String returns the preamble as comment
+func (p *cgoPreamble) String() string {
+	lines := []string{}
+	for i, chunk := range p.chunks {
+		if i > 0 && !(isCDirective(chunk) && isCDirective(p.chunks[i-1])) {
+			// consecutive preprocessor directives stay together
+			lines = append(lines, "//")
+		}
+		for _, line := range strings.Split(chunk, "\n") {
+			lines = append(lines, strings.TrimRight("// "+line, " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cChunks splits C code into preprocessor directives and top level definitions.
+func cChunks(code string) []string {
+	chunks := []string{}
+	current := []string{}
+	depth := 0
+	flush := func() {
+		if len(current) > 0 {
+			chunks = append(chunks, strings.Join(current, "\n"))
+			current = []string{}
+		}
+	}
+
+	lines := strings.Split(code, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" && depth == 0 {
+			flush()
+			continue
+		}
+		if strings.HasPrefix(trimmed, "#") && depth == 0 {
+			flush()
+			// a directive can be continued with a backslash
+			for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+				i++
+				line += "\n" + strings.TrimRight(lines[i], " \t")
+			}
+			chunks = append(chunks, line)
+			continue
+		}
+		current = append(current, line)
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if depth == 0 && (strings.HasSuffix(trimmed, ";") || strings.HasSuffix(trimmed, "}")) {
+			flush()
+		}
+	}
+	flush()
+	return chunks
+}
+
+// cDefinedName returns the name which is defined by a chunk of C code.
+// If the name can't be found, an empty string is returned.
+func cDefinedName(chunk string) string {
+	code := strings.TrimSpace(chunk)
+	if m := cDefine.FindStringSubmatch(code); m != nil {
+		return m[1]
+	}
+	if isCDirective(code) {
+		return ""
+	}
+	if m := cTypedef.FindStringSubmatch(code); m != nil {
+		return m[1]
+	}
+	if m := cTagged.FindStringSubmatch(code); m != nil {
+		return m[1] + " " + m[2]
+	}
+	if m := cFunction.FindStringSubmatch(code); m != nil {
+		return m[1]
+	}
+	if m := cVariable.FindStringSubmatch(code); m != nil && !strings.Contains(code, "(") {
+		return m[1]
+	}
+	return ""
+}
+
+// isCDirective checks whether a chunk of C code is a preprocessor directive
+func isCDirective(chunk string) bool {
+	return strings.HasPrefix(strings.TrimSpace(chunk), "#")
+}
@@ -0,0 +1,91 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// TypeError is an error found by the type check of the merged file.
+type TypeError struct {
+	// Pos is the position in the source file, if the error is
+	// located in a merged declaration. Otherwise it is the
+	// position in the merged file.
+	Pos token.Position `json:"pos"`
+	Msg string         `json:"msg"`
+}
+
+func (e TypeError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Pos, e.Msg)
+}
+
+// ErrTypeCheck is returned if the merged file doesn't type check.
+type ErrTypeCheck struct {
+	Errors []TypeError
+}
+
+func (e ErrTypeCheck) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "merged file doesn't type check:\n" + strings.Join(msgs, "\n")
+}
+
+// Check type checks the formatted merged file. Dependencies are
+// imported by the given importer. The positions of the errors
+// are mapped back to the source files.
+func (m *Merger) Check(formatted []byte, fileName string, importer types.Importer) (*types.Package, error) {
+	fset, out, decls, err := m.parseFormatted(formatted, fileName)
+	if err != nil {
+		return nil, err
+	}
+	mappings, err := m.nodeMappings(fset, decls)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := []TypeError{}
+	conf := types.Config{
+		Importer:    importer,
+		FakeImportC: true,
+		Error: func(err error) {
+			if typeErr, ok := err.(types.Error); ok {
+				pos := fset.PositionFor(typeErr.Pos, false)
+				errs = append(errs, TypeError{Pos: m.sourcePosition(mappings, pos), Msg: typeErr.Msg})
+			} else {
+				errs = append(errs, TypeError{Msg: err.Error()})
+			}
+		},
+	}
+	pkg, _ := conf.Check(out.Name.Name, fset, []*ast.File{out}, nil)
+
+	if len(errs) > 0 {
+		return pkg, ErrTypeCheck{Errors: errs}
+	}
+	return pkg, nil
+}
+
+// sourcePosition maps a position of the formatted merged file to the source file
+// of the innermost func, spec or struct field which contains it. Lines are mapped
+// relative to the start of the node, so the position is exact as long as the
+// node was formatted in the source file.
+func (m *Merger) sourcePosition(mappings []nodeMapping, pos token.Position) token.Position {
+	var found *nodeMapping
+	for i, mapping := range mappings {
+		if pos.Line >= mapping.out.Start && pos.Line <= mapping.out.End {
+			// fields follow their spec, so the last match is the innermost
+			found = &mappings[i]
+		}
+	}
+	if found == nil {
+		return pos
+	}
+	source := found.src
+	source.Line += pos.Line - found.out.Start
+	source.Column = pos.Column
+	source.Offset = 0
+	return source
+}
@@ -0,0 +1,202 @@
+package pkg
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build/constraint"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// printerConfig is the same config gofmt uses
+var printerConfig = printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
+// headerComments returns all comments before the package clause, which are
+// not the package documentation or a build constraint.
+func headerComments(file *ast.File) []*ast.CommentGroup {
+	header := []*ast.CommentGroup{}
+	for _, c := range file.Comments {
+		if c.End() >= file.Package {
+			break
+		}
+		if c != file.Doc && !isConstraint(c) && !isGenerate(c) {
+			header = append(header, c)
+		}
+	}
+	return header
+}
+
+// isConstraint checks whether a comment group contains a build constraint
+func isConstraint(c *ast.CommentGroup) bool {
+	for _, line := range c.List {
+		if constraint.IsGoBuild(line.Text) || constraint.IsPlusBuild(line.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGenerate checks whether a comment group only contains //go:generate directives
+func isGenerate(c *ast.CommentGroup) bool {
+	for _, line := range c.List {
+		if !strings.HasPrefix(line.Text, generateDirective) {
+			return false
+		}
+	}
+	return true
+}
+
+// floatingComments returns the comments between the declarations of a file, which
+// belong to no declaration. The header, //go:generate directives and line comments
+// after a declaration are not part of it.
+func floatingComments(fset *token.FileSet, file *ast.File) []*ast.CommentGroup {
+	floating := []*ast.CommentGroup{}
+	for _, c := range file.Comments {
+		if c.Pos() < file.Name.End() || insideDecl(file, c) || isGenerate(c) || afterDecl(fset, file, c) {
+			continue
+		}
+		floating = append(floating, c)
+	}
+	return floating
+}
+
+// afterDecl checks whether a comment starts on the line a declaration ends
+func afterDecl(fset *token.FileSet, file *ast.File, c *ast.CommentGroup) bool {
+	line := fset.Position(c.Pos()).Line
+	for _, decl := range file.Decls {
+		if fset.Position(decl.End()).Line == line {
+			return true
+		}
+	}
+	return false
+}
+
+// commentText returns the raw text of a comment group, with comment markers
+func commentText(c *ast.CommentGroup) string {
+	lines := make([]string, len(c.List))
+	for i, comment := range c.List {
+		lines[i] = comment.Text
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renameDoc renames the first word of a doc comment, if it is the old
+// name, so that the documentation still describes the declaration.
+func renameDoc(doc *ast.CommentGroup, oldName, newName string) {
+	if doc == nil {
+		return
+	}
+	for _, c := range doc.List {
+		if rest := strings.TrimPrefix(c.Text, "// "+oldName); rest != c.Text {
+			if rest == "" || strings.HasPrefix(rest, " ") {
+				c.Text = "// " + newName + rest
+			}
+			return
+		}
+		if !constraint.IsGoBuild(c.Text) && !strings.HasPrefix(c.Text, "//go:") {
+			return
+		}
+	}
+}
+
+// renameDocs renames the documentation of the declaration with the given name.
+func renameDocs(file *ast.File, oldName, newName string) {
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil && decl.Name.Name == newName {
+				renameDoc(decl.Doc, oldName, newName)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				names := declNames(&ast.GenDecl{Tok: decl.Tok, Specs: []ast.Spec{spec}})
+				if len(names) != 1 || names[0] != newName {
+					continue
+				}
+				if len(decl.Specs) == 1 {
+					renameDoc(decl.Doc, oldName, newName)
+				}
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					renameDoc(spec.Doc, oldName, newName)
+				case *ast.ValueSpec:
+					renameDoc(spec.Doc, oldName, newName)
+				}
+			}
+		}
+	}
+}
+
+// specComments returns the comments of the specs which declare the given name.
+func specComments(decls []ast.Decl, name string) []*ast.CommentGroup {
+	comments := []*ast.CommentGroup{}
+	for _, decl := range decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			var doc, comment *ast.CommentGroup
+			switch spec := spec.(type) {
+			case *ast.TypeSpec:
+				if spec.Name.Name == name {
+					doc, comment = spec.Doc, spec.Comment
+				}
+			case *ast.ValueSpec:
+				if len(spec.Names) == 1 && spec.Names[0].Name == name {
+					doc, comment = spec.Doc, spec.Comment
+				}
+			}
+			for _, c := range []*ast.CommentGroup{doc, comment} {
+				if c != nil {
+					comments = append(comments, c)
+				}
+			}
+		}
+	}
+	return comments
+}
+
+// fieldText prints a field of a struct, including its comments.
+// The annotation is added at the end of the documentation.
+func fieldText(fset *token.FileSet, field *ast.Field, name, annotation string) (string, error) {
+	text := &bytes.Buffer{}
+	if field.Doc != nil {
+		text.WriteString(commentText(field.Doc))
+		text.WriteString("\n")
+	}
+	if annotation != "" {
+		text.WriteString(annotation)
+		text.WriteString("\n")
+	}
+	text.WriteString(name)
+	text.WriteString(" ")
+	if err := printerConfig.Fprint(text, fset, field.Type); err != nil {
+		return "", err
+	}
+	if field.Tag != nil {
+		text.WriteString(" ")
+		text.WriteString(field.Tag.Value)
+	}
+	if field.Comment != nil {
+		text.WriteString(" ")
+		text.WriteString(commentText(field.Comment))
+	}
+	return text.String(), nil
+}
+
+// declPos returns the start of a declaration, including its documentation.
+func declPos(decl ast.Decl) token.Pos {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if decl.Doc != nil {
+			return decl.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if decl.Doc != nil {
+			return decl.Doc.Pos()
+		}
+	}
+	return decl.Pos()
+}
@@ -0,0 +1,264 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ConstraintMode defines how build constraints of the source files are handled.
+type ConstraintMode string
+
+const (
+	// ConstraintCombine merges files with compatible constraints and
+	// writes the combined constraint. Incompatible files are rejected.
+	ConstraintCombine ConstraintMode = "combine"
+	// ConstraintSelect merges only the files which match the target
+	// GOOS, GOARCH and tags. The constraints of the selected files get combined.
+	ConstraintSelect ConstraintMode = "select"
+	// ConstraintSplit merges each group of files with the same
+	// constraint into its own file.
+	ConstraintSplit ConstraintMode = "split"
+)
+
+// ParseConstraintMode parses the name of a constraint mode. An empty name is ConstraintCombine.
+func ParseConstraintMode(mode string) (ConstraintMode, error) {
+	switch m := ConstraintMode(mode); m {
+	case "":
+		return ConstraintCombine, nil
+	case ConstraintCombine, ConstraintSelect, ConstraintSplit:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown constraint mode %q", mode)
+}
+
+// knownOS and knownArch are the GOOS and GOARCH values,
+// which are implied by file name suffixes
+var knownOS = []string{
+	"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios", "js",
+	"linux", "nacl", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows", "zos",
+}
+
+var knownArch = []string{
+	"386", "amd64", "amd64p32", "arm", "armbe", "arm64", "arm64be", "loong64", "mips",
+	"mipsle", "mips64", "mips64le", "mips64p32", "mips64p32le", "ppc", "ppc64", "ppc64le",
+	"riscv", "riscv64", "s390", "s390x", "sparc", "sparc64", "wasm",
+}
+
+// unixOS are the GOOS values which satisfy the "unix" constraint
+var unixOS = []string{
+	"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos",
+	"ios", "linux", "netbsd", "openbsd", "solaris",
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FileConstraint returns the build constraint of a file. It is the
+// //go:build line combined with the GOOS and GOARCH suffix of the file name.
+// Like the go command, the // +build lines are only used if the file has
+// no //go:build line. A file without any constraint returns nil.
+func FileConstraint(fileName string, file *ast.File) (constraint.Expr, error) {
+	var goBuild, plusBuild constraint.Expr
+	for _, c := range file.Comments {
+		if c.Pos() >= file.Package {
+			break
+		}
+		for _, line := range c.List {
+			isGoBuild := constraint.IsGoBuild(line.Text)
+			if !isGoBuild && !constraint.IsPlusBuild(line.Text) {
+				continue
+			}
+			e, err := constraint.Parse(line.Text)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", fileName, err)
+			}
+			if isGoBuild {
+				goBuild = andConstraint(goBuild, e)
+			} else {
+				// multiple +build lines must all be satisfied
+				plusBuild = andConstraint(plusBuild, e)
+			}
+		}
+	}
+	expr := goBuild
+	if expr == nil {
+		expr = plusBuild
+	}
+	return andConstraint(expr, fileNameConstraint(fileName)), nil
+}
+
+// fileNameConstraint returns the constraint implied by the
+// name_GOOS_GOARCH.go, name_GOOS.go or name_GOARCH.go pattern.
+func fileNameConstraint(fileName string) constraint.Expr {
+	name := strings.TrimSuffix(filepath.Base(fileName), ".go")
+	name = strings.TrimSuffix(name, "_test")
+	parts := strings.Split(name, "_")
+	if len(parts) < 2 {
+		return nil
+	}
+	last := parts[len(parts)-1]
+	if len(parts) >= 3 && contains(knownOS, parts[len(parts)-2]) && contains(knownArch, last) {
+		return &constraint.AndExpr{
+			X: &constraint.TagExpr{Tag: parts[len(parts)-2]},
+			Y: &constraint.TagExpr{Tag: last},
+		}
+	}
+	if contains(knownOS, last) || contains(knownArch, last) {
+		return &constraint.TagExpr{Tag: last}
+	}
+	return nil
+}
+
+// andConstraint combines two constraints, each can be nil.
+func andConstraint(a, b constraint.Expr) constraint.Expr {
+	if a == nil {
+		return b
+	}
+	if b == nil || a.String() == b.String() {
+		return a
+	}
+	return &constraint.AndExpr{X: a, Y: b}
+}
+
+// MatchConstraint checks whether a constraint is satisfied
+// by the given target. A nil constraint always matches.
+func MatchConstraint(expr constraint.Expr, goos, goarch string, tags []string) bool {
+	if expr == nil {
+		return true
+	}
+	return expr.Eval(func(tag string) bool {
+		switch {
+		case tag == goos || tag == goarch || contains(tags, tag):
+			return true
+		case tag == "unix":
+			return contains(unixOS, goos)
+		case tag == "gc":
+			return true
+		case strings.HasPrefix(tag, "go1."):
+			// release tags ... we assume a recent go version
+			return true
+		}
+		return false
+	})
+}
+
+// SatisfiableConstraint checks whether there is any target which
+// satisfies the constraint. Exactly one GOOS and GOARCH are set,
+// all other tags can be freely chosen.
+func SatisfiableConstraint(expr constraint.Expr) bool {
+	if expr == nil {
+		return true
+	}
+	freeTags := []string{}
+	collectTags(expr, func(tag string) {
+		if !contains(knownOS, tag) && !contains(knownArch, tag) && tag != "unix" &&
+			!contains(freeTags, tag) {
+			freeTags = append(freeTags, tag)
+		}
+	})
+	sort.Strings(freeTags)
+	if len(freeTags) > 10 {
+		// too many combinations ... assume the best
+		return true
+	}
+
+	for _, goos := range knownOS {
+		for _, goarch := range knownArch {
+			for set := 0; set < 1<<len(freeTags); set++ {
+				tags := []string{}
+				for i, tag := range freeTags {
+					if set&(1<<i) != 0 {
+						tags = append(tags, tag)
+					}
+				}
+				if evalConstraint(expr, goos, goarch, tags) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// evalConstraint evaluates a constraint, without any implicit tags.
+func evalConstraint(expr constraint.Expr, goos, goarch string, tags []string) bool {
+	return expr.Eval(func(tag string) bool {
+		if tag == "unix" {
+			return contains(unixOS, goos)
+		}
+		return tag == goos || tag == goarch || contains(tags, tag)
+	})
+}
+
+func collectTags(expr constraint.Expr, f func(tag string)) {
+	switch e := expr.(type) {
+	case *constraint.TagExpr:
+		f(e.Tag)
+	case *constraint.NotExpr:
+		collectTags(e.X, f)
+	case *constraint.AndExpr:
+		collectTags(e.X, f)
+		collectTags(e.Y, f)
+	case *constraint.OrExpr:
+		collectTags(e.X, f)
+		collectTags(e.Y, f)
+	}
+}
+
+// ConstraintFileSuffix returns a file name suffix for a constraint. The
+// suffix ends with "_build", so that it doesn't imply a GOOS or GOARCH itself.
+func ConstraintFileSuffix(expr constraint.Expr) string {
+	if expr == nil {
+		return ""
+	}
+	replacer := strings.NewReplacer("!", "not_", "&&", "and", "||", "or", "(", "", ")", "", " ", "_", ".", "_")
+	return "_" + replacer.Replace(expr.String()) + "_build"
+}
+
+// mergeConstraint combines the build constraint of b with the
+// constraint of the merged file. If b should not be merged,
+// because it isn't selected, false gets returned.
+func (m *Merger) mergeConstraint(b *ast.File) (bool, error) {
+	fileName := m.Fset.Position(b.Pos()).Filename
+	c, err := FileConstraint(fileName, b)
+	if err != nil {
+		return false, err
+	}
+
+	if m.Options.Constraints == ConstraintSelect {
+		goos, goarch := m.Options.GOOS, m.Options.GOARCH
+		if goos == "" {
+			goos = runtime.GOOS
+		}
+		if goarch == "" {
+			goarch = runtime.GOARCH
+		}
+		if !MatchConstraint(c, goos, goarch, m.Options.Tags) {
+			m.emit(FileSkipped{File: fileName, Constraint: c.String(), GOOS: goos, GOARCH: goarch})
+			return false, nil
+		}
+	}
+
+	combined := andConstraint(m.constraint, c)
+	if !SatisfiableConstraint(combined) {
+		return false, fmt.Errorf("build constraint %q of %v is incompatible with %q", c, fileName, m.constraint)
+	}
+	m.constraint = combined
+	return true, nil
+}
+
+// Constraint returns the combined build constraint of all merged files.
+func (m *Merger) Constraint() constraint.Expr {
+	return m.constraint
+}
@@ -0,0 +1,67 @@
+package pkg
+
+import "go/token"
+
+// Outcome is what a merge did with a declaration or an import.
+type Outcome string
+
+const (
+	// OutcomeKept is a declaration or import, which is written as it is
+	OutcomeKept Outcome = "kept"
+	// OutcomeDeduped is a duplicate of an already merged declaration or import
+	OutcomeDeduped Outcome = "deduped"
+	// OutcomeRenamed is a declaration, which conflicts with an already merged one
+	OutcomeRenamed Outcome = "renamed"
+	// OutcomeFieldsMerged is a struct, whose additional fields were added to the already merged struct
+	OutcomeFieldsMerged Outcome = "fields-merged"
+	// OutcomeImportAliased is an import, which is written with another name
+	OutcomeImportAliased Outcome = "import-aliased"
+	// OutcomeRemoved is a declaration, which was removed by a Shake or Extract
+	OutcomeRemoved Outcome = "removed"
+	// OutcomeImportMerged is an import of a merged package, which is removed,
+	// because its references refer to the merged declarations
+	OutcomeImportMerged Outcome = "import-merged"
+)
+
+// Decision records what a merge did with a declaration or an import of a source file.
+type Decision struct {
+	// Name in the source file
+	Name string `json:"name"`
+	// NewName in the merged file, if it differs
+	NewName string `json:"newName,omitempty"`
+	// Kind is func, method, type, var, const or import
+	Kind string `json:"kind"`
+	// Path of an import and the NewPath it was rewritten to
+	Path    string         `json:"path,omitempty"`
+	NewPath string         `json:"newPath,omitempty"`
+	Pos     token.Position `json:"pos"`
+	Outcome Outcome        `json:"outcome"`
+	Reason  string         `json:"reason,omitempty"`
+	// Mismatch is the difference to the already merged declaration, as found by NodeEqual
+	Mismatch string `json:"mismatch,omitempty"`
+	// Existing is the position of the already merged declaration it was compared with
+	Existing *token.Position `json:"existing,omitempty"`
+	// Fields which were added to the already merged struct
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Decisions returns the decisions of the merge in the order they were made.
+func (m *Merger) Decisions() []Decision {
+	return append([]Decision{}, m.decisions...)
+}
+
+func (m *Merger) addDecision(d Decision) {
+	if d.NewName == d.Name {
+		d.NewName = ""
+	}
+	m.decisions = append(m.decisions, d)
+}
+
+// existing returns the position of an already merged declaration
+func (m *Merger) existing(name string) *token.Position {
+	if origin := m.origins[name]; origin != nil {
+		pos := origin.Pos
+		return &pos
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"go/ast"
+)
+
+// declNames returns the names of everything a declaration declares.
+// Methods are named by funcName.
+func declNames(decl ast.Decl) []string {
+	names := []string{}
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		names = append(names, funcName(decl))
+	case *ast.GenDecl:
+		for _, spec := range decl.Specs {
+			switch spec := spec.(type) {
+			case *ast.TypeSpec:
+				names = append(names, spec.Name.Name)
+			case *ast.ValueSpec:
+				for _, name := range spec.Names {
+					names = append(names, name.Name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// declRefs finds all identifiers a declaration or spec references.
+// The names of selected fields or methods are not part of it.
+func declRefs(decl ast.Node) map[string]bool {
+	refs := map[string]bool{}
+	var inspect func(n ast.Node) bool
+	inspect = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, inspect)
+			return false
+		case *ast.Ident:
+			refs[n.Name] = true
+		}
+		return true
+	}
+	ast.Inspect(decl, inspect)
+	return refs
+}
@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	linknameDirective = "//go:linkname "
+	embedDirective    = "//go:embed "
+	generateDirective = "//go:generate "
+)
+
+// renameLinknames renames the local name of //go:linkname directives.
+func renameLinknames(file *ast.File, oldName, newName string) {
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if !strings.HasPrefix(c.Text, linknameDirective) {
+				continue
+			}
+			args := strings.Fields(strings.TrimPrefix(c.Text, linknameDirective))
+			if len(args) > 0 && args[0] == oldName {
+				args[0] = newName
+				c.Text = linknameDirective + strings.Join(args, " ")
+			}
+		}
+	}
+}
+
+// mergeDirectives handles the directives of b, which depend on the
+// location of the source file or which are not part of a declaration.
+func (m *Merger) mergeDirectives(b *ast.File) error {
+	fileName := m.Fset.Position(b.Pos()).Filename
+
+	for _, group := range b.Comments {
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, embedDirective) {
+				text, err := m.rewriteEmbed(fileName, c.Text)
+				if err != nil {
+					return err
+				}
+				c.Text = text
+			}
+		}
+
+		if group == b.Doc || insideDecl(b, group) {
+			continue
+		}
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, generateDirective) {
+				m.generate = appendUnique(m.generate, c.Text)
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteEmbed rewrites the patterns of a //go:embed directive, so
+// that they are relative to the directory of the merged file.
+func (m *Merger) rewriteEmbed(fileName, directive string) (string, error) {
+	if m.BaseDir == "" {
+		return directive, nil
+	}
+	patterns, err := embedPatterns(strings.TrimPrefix(directive, embedDirective))
+	if err != nil {
+		return "", fmt.Errorf("%v: %w", fileName, err)
+	}
+	baseDir, err := filepath.Abs(m.BaseDir)
+	if err != nil {
+		return "", err
+	}
+	srcDir, err := filepath.Abs(filepath.Dir(fileName))
+	if err != nil {
+		return "", err
+	}
+
+	for i, pattern := range patterns {
+		prefix := ""
+		if p := strings.TrimPrefix(pattern, "all:"); p != pattern {
+			prefix, pattern = "all:", p
+		}
+		rel, err := filepath.Rel(baseDir, filepath.Join(srcDir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return "", err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			m.emit(Warning{Msg: fmt.Sprintf("%v: embed pattern %q is outside of the directory of the merged file", fileName, pattern)})
+		}
+		patterns[i] = prefix + rel
+		if strings.ContainsAny(patterns[i], " \t\"") {
+			patterns[i] = strconv.Quote(patterns[i])
+		}
+	}
+	return embedDirective + strings.Join(patterns, " "), nil
+}
+
+// embedPatterns splits the patterns of a //go:embed directive.
+// Patterns can be quoted, if they contain spaces.
+func embedPatterns(args string) ([]string, error) {
+	patterns := []string{}
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		var pattern string
+		switch args[0] {
+		case '"', '`':
+			end := strings.IndexByte(args[1:], args[0])
+			if end == -1 {
+				return nil, fmt.Errorf("invalid quoted embed pattern %v", args)
+			}
+			unquoted, err := strconv.Unquote(args[:end+2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted embed pattern %v", args)
+			}
+			pattern, args = unquoted, args[end+2:]
+		default:
+			end := strings.IndexAny(args, " \t")
+			if end == -1 {
+				end = len(args)
+			}
+			pattern, args = args[:end], args[end:]
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// insideDecl checks whether a comment belongs to a declaration
+func insideDecl(file *ast.File, c *ast.CommentGroup) bool {
+	for _, decl := range file.Decls {
+		if c.Pos() >= declPos(decl) && c.End() <= decl.End() {
+			return true
+		}
+	}
+	return false
+}
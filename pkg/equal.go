@@ -77,6 +77,8 @@ func NodeEqual(a, b ast.Node) error {
 		return RangeStmtEqual(a, b.(*ast.RangeStmt))
 	case *ast.KeyValueExpr:
 		return KeyValueExprEqual(a, b.(*ast.KeyValueExpr))
+	case *ast.ExprStmt:
+		return ExprStmtEqual(a, b.(*ast.ExprStmt))
 	}
 	return fmt.Errorf("unknown node type %q", aT)
 }
@@ -121,7 +123,8 @@ func FieldListEqual(a, b *ast.FieldList) error {
 	aAdditionalFields := []string{}
 	bAdditionalFields := []string{}
 
-	for name, aField := range aFields {
+	for _, name := range FieldNames(a) {
+		aField := aFields[name]
 		bField, exists := bFields[name]
 		if !exists {
 			aAdditionalFields = append(aAdditionalFields, name)
@@ -136,8 +139,10 @@ func FieldListEqual(a, b *ast.FieldList) error {
 		delete(bFields, name)
 	}
 
-	for name := range bFields {
-		bAdditionalFields = append(bAdditionalFields, name)
+	for _, name := range FieldNames(b) {
+		if _, additional := bFields[name]; additional {
+			bAdditionalFields = append(bAdditionalFields, name)
+		}
 	}
 
 	if len(aAdditionalFields) > 0 || len(bAdditionalFields) > 0 {
@@ -193,6 +198,15 @@ func SelectorExprEqual(a, b *ast.SelectorExpr) error {
 	if err := IdentEqual(a.Sel, b.Sel); err != nil {
 		return fmt.Errorf("selector name not equal: %w", err)
 	}
+	aPath, aQualified := qualifierPath(a.X)
+	bPath, bQualified := qualifierPath(b.X)
+	if aQualified || bQualified {
+		// qualifiers refer to the same package if they have the same import path
+		if aPath != bPath {
+			return fmt.Errorf("selector source not equal: %q != %q", aPath, bPath)
+		}
+		return nil
+	}
 	if err := NodeEqual(a.X, b.X); err != nil {
 		return fmt.Errorf("selector source not equal: %w", err)
 	}
@@ -229,6 +243,12 @@ func FuncTypeEqual(a, b *ast.FuncType) error {
 }
 
 func BlockStmtEqual(a, b *ast.BlockStmt) error {
+	if a == nil || b == nil {
+		if a != b {
+			return fmt.Errorf("only one block is nil")
+		}
+		return nil
+	}
 	if len(a.List) != len(b.List) {
 		return fmt.Errorf("different stmt count")
 	}
@@ -407,3 +427,10 @@ func KeyValueExprEqual(a, b *ast.KeyValueExpr) error {
 	}
 	return nil
 }
+
+func ExprStmtEqual(a, b *ast.ExprStmt) error {
+	if err := NodeEqual(a.X, b.X); err != nil {
+		return fmt.Errorf("expr not equal: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package pkg
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Level is the importance of an event. The levels match the levels of log/slog.
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+)
+
+func (l Level) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	}
+	return "WARN"
+}
+
+// Event is something which happened during a merge.
+type Event interface {
+	Level() Level
+	String() string
+}
+
+// EventHandler handles the events of a merge, like a slog.Handler handles records.
+type EventHandler interface {
+	// Enabled reports whether events of the level are handled
+	Enabled(level Level) bool
+	Handle(event Event)
+}
+
+// LogHandler writes the events to a logger.
+type LogHandler struct {
+	// Logger defaults to the standard logger
+	Logger *log.Logger
+	// Level is the minimum level of the written events
+	Level Level
+}
+
+// Enabled implements EventHandler
+func (h LogHandler) Enabled(level Level) bool {
+	return level >= h.Level
+}
+
+// Handle implements EventHandler
+func (h LogHandler) Handle(event Event) {
+	msg := event.String()
+	if event.Level() >= LevelWarn {
+		msg = "warning: " + msg
+	}
+	if h.Logger == nil {
+		log.Print(msg)
+	} else {
+		h.Logger.Print(msg)
+	}
+}
+
+// emit passes the event to the event handler of the merger, a nil handler discards all events
+func (m *Merger) emit(event Event) {
+	if m.Events != nil && m.Events.Enabled(event.Level()) {
+		m.Events.Handle(event)
+	}
+}
+
+// ImportConflict is an import whose name is already used by an import of another path.
+type ImportConflict struct {
+	Name, Path, ExistingPath, NewName string
+}
+
+func (e ImportConflict) Level() Level { return LevelInfo }
+
+func (e ImportConflict) String() string {
+	return fmt.Sprintf("import name conflict %q with paths %q != %q, rename %q -> %q", e.Name, e.Path, e.ExistingPath, e.Name, e.NewName)
+}
+
+// ImportResolved is an import of an already imported path, which gets the existing name.
+type ImportResolved struct {
+	Path, Name, ExistingName string
+}
+
+func (e ImportResolved) Level() Level { return LevelDebug }
+
+func (e ImportResolved) String() string {
+	return fmt.Sprintf("import %q resolved %q -> %q", e.Path, e.Name, e.ExistingName)
+}
+
+// ImportDuplicated is an import of an already imported path, which is imported again,
+// because the existing name is declared otherwise by the file.
+type ImportDuplicated struct {
+	Path, Name, ExistingName string
+}
+
+func (e ImportDuplicated) Level() Level { return LevelInfo }
+
+func (e ImportDuplicated) String() string {
+	return fmt.Sprintf("import %q imported again as %q, because %q is used otherwise", e.Path, e.Name, e.ExistingName)
+}
+
+// ImportRewritten is an import path, which was changed by an import rewrite.
+type ImportRewritten struct {
+	Path, NewPath string
+}
+
+func (e ImportRewritten) Level() Level { return LevelDebug }
+
+func (e ImportRewritten) String() string {
+	return fmt.Sprintf("rewrite import %q -> %q", e.Path, e.NewPath)
+}
+
+// Dedup is a declaration, which was removed, because it is a duplicate.
+type Dedup struct {
+	Name string
+}
+
+func (e Dedup) Level() Level { return LevelDebug }
+
+func (e Dedup) String() string {
+	return fmt.Sprintf("removed duplicate %q", e.Name)
+}
+
+// Rename is a declaration, which was renamed because of a name conflict.
+type Rename struct {
+	Name, NewName string
+	// Mismatch is the difference to the conflicting declaration
+	Mismatch string
+}
+
+func (e Rename) Level() Level { return LevelInfo }
+
+func (e Rename) String() string {
+	return fmt.Sprintf("name conflict of declaration %q: %v, rename %q -> %q", e.Name, e.Mismatch, e.Name, e.NewName)
+}
+
+// FieldsMerged is a struct, which got the additional fields of a duplicate.
+type FieldsMerged struct {
+	Struct string
+	Fields []string
+}
+
+func (e FieldsMerged) Level() Level { return LevelInfo }
+
+func (e FieldsMerged) String() string {
+	return fmt.Sprintf("add additional fields (%v) to %v", strings.Join(e.Fields, ","), e.Struct)
+}
+
+// FileSkipped is a source file, whose build constraint doesn't match the target.
+type FileSkipped struct {
+	File, Constraint, GOOS, GOARCH string
+}
+
+func (e FileSkipped) Level() Level { return LevelInfo }
+
+func (e FileSkipped) String() string {
+	return fmt.Sprintf("skip %v: build constraint %q doesn't match %v/%v", e.File, e.Constraint, e.GOOS, e.GOARCH)
+}
+
+// Warning is a problem, which doesn't stop the merge.
+type Warning struct {
+	Msg string
+}
+
+func (e Warning) Level() Level { return LevelWarn }
+
+func (e Warning) String() string {
+	return e.Msg
+}
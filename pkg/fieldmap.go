@@ -34,3 +34,17 @@ func FieldListToMap(fl *ast.FieldList) (map[string]Field, error) {
 	}
 	return fields, nil
 }
+
+// FieldNames returns the names of all fields in declaration order
+func FieldNames(fl *ast.FieldList) []string {
+	if fl == nil {
+		return nil
+	}
+	names := []string{}
+	for _, f := range fl.List {
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+	}
+	return names
+}
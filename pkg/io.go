@@ -8,16 +8,22 @@ import (
 	"os"
 )
 
+// fileSet holds the positions of the files loaded by LoadAstFile.
+// NewMerger uses it, so that the loaded files can be merged.
+var fileSet = token.NewFileSet()
+
+// LoadAstFile parses a file with its comments. The positions are
+// part of the FileSet, which the Merger of NewMerger uses.
 func LoadAstFile(file string) (*ast.File, error) {
-	fs := token.NewFileSet()
-	return parser.ParseFile(fs, file, nil, 0)
+	return parser.ParseFile(fileSet, file, nil, parser.ParseComments)
 }
 
+// WriteAstFile formats a file, which was loaded by LoadAstFile or has no positions.
 func WriteAstFile(file string, ast *ast.File) error {
 	f, err := os.Create(file)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	return format.Node(f, token.NewFileSet(), ast)
+	return format.Node(f, fileSet, ast)
 }
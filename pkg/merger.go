@@ -1,10 +1,11 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"go/ast"
+	"go/build/constraint"
 	"go/token"
-	"log"
 	"path"
 	"strconv"
 	"strings"
@@ -12,12 +13,72 @@ import (
 
 type Merger struct {
 	File ast.File
+	// Fset holds the positions of all merged files. The files must be parsed
+	// into it, e.g. by LoadAstFile, which uses the FileSet of NewMerger.
+	Fset    *token.FileSet
+	Options Options
+
+	// BaseDir is the directory of the merged file. Annotations
+	// contain source file names relative to it.
+	BaseDir string
+
+	// Header is written before everything else
+	Header string
+
+	// Events handles the events of the merge, nil discards them
+	Events EventHandler
+
+	// Packages are the import paths of the merged packages. Their imports
+	// are removed and qualified identifiers refer to the merged declarations.
+	Packages []string
 
 	declares    map[string]ast.Node
 	imports     map[string]string
+	importNames map[string]string
 	importsDecl ast.GenDecl
+
+	unnamedImports map[string]bool
+
+	usedRewrites map[ImportRewrite]bool
+
+	comments []*ast.CommentGroup
+	dropped  map[*ast.CommentGroup]bool
+	// floating comments between the declarations of the source files
+	floating []*ast.CommentGroup
+	header   []string
+	docs     []string
+	generate []string
+
+	origins     map[string]*Origin
+	originNames []string
+	// unnamedOrigins are the origins of init functions and blank names by their position
+	unnamedOrigins map[token.Pos]*Origin
+
+	constraint constraint.Expr
+
+	cgo *cgoPreamble
+
+	// renames of the declarations of each merged package by import path
+	renames    map[string]map[string]string
+	references []reference
+
+	decisions []Decision
+
+	// iotas are the indexes of the declared constants, whose values depend on iota
+	iotas map[string]int
+
+	// fields which were added to the structs of the merged file
+	mergedFields map[*ast.StructType][]mergedField
+
+	// violations of the import policy of all merged files
+	violations []ImportViolation
+
+	// ctx stops the merge, if it is done, see MergeSources
+	ctx context.Context
 }
 
+// NewMerger creates a merger of the files loaded by LoadAstFile,
+// files of another FileSet need their own Fset.
 func NewMerger(pkgName string) *Merger {
 	return &Merger{
 		File: ast.File{
@@ -25,131 +86,426 @@ func NewMerger(pkgName string) *Merger {
 			Imports: []*ast.ImportSpec{},
 			Decls:   []ast.Decl{},
 		},
-		declares: map[string]ast.Node{},
-		imports:  map[string]string{},
+		Fset:           fileSet,
+		declares:       map[string]ast.Node{},
+		iotas:          map[string]int{},
+		imports:        map[string]string{},
+		importNames:    map[string]string{},
+		unnamedImports: map[string]bool{},
 		importsDecl: ast.GenDecl{
 			Tok:   token.IMPORT,
 			Specs: []ast.Spec{},
 		},
+		usedRewrites:   map[ImportRewrite]bool{},
+		comments:       []*ast.CommentGroup{},
+		dropped:        map[*ast.CommentGroup]bool{},
+		origins:        map[string]*Origin{},
+		unnamedOrigins: map[token.Pos]*Origin{},
+		cgo:            newCgoPreamble(),
+		renames:        map[string]map[string]string{},
+		mergedFields:   map[*ast.StructType][]mergedField{},
 	}
 }
 
+// ctxErr returns the error of the context, if the merge was stopped
+func (m *Merger) ctxErr() error {
+	if m.ctx == nil {
+		return nil
+	}
+	return m.ctx.Err()
+}
+
+// Merge merges a single source file.
 func (m *Merger) Merge(b *ast.File, duplicatePostfix string) error {
+	return m.MergePackage([]*ast.File{b}, "", duplicatePostfix)
+}
+
+// MergePackage merges all files of a package. The declarations of the files
+// are never deduplicated or renamed against each other, only against the
+// declarations of other packages. The import path is optional, it is needed
+// to resolve references of other merged packages to this package.
+func (m *Merger) MergePackage(files []*ast.File, importPath, duplicatePostfix string) error {
+	return m.mergePackage(files, importPath, duplicatePostfix, "")
+}
+
+// BundlePackage merges all files of a dependency package. All package level
+// declarations get the prefix, references of other merged packages to
+// them are rewritten.
+func (m *Merger) BundlePackage(files []*ast.File, importPath, prefix, duplicatePostfix string) error {
+	return m.mergePackage(files, importPath, duplicatePostfix, prefix)
+}
+
+func (m *Merger) mergePackage(files []*ast.File, importPath, duplicatePostfix, prefix string) error {
+	selected := []*ast.File{}
+	for _, file := range files {
+		ok, err := m.mergeConstraint(file)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		// the package documentation of a bundled package doesn't describe the merged package
+		m.mergeHeader(file, prefix == "")
+		if err := m.mergeDirectives(file); err != nil {
+			return err
+		}
+		m.floating = append(m.floating, floatingComments(m.Fset, file)...)
+		if preamble, ok := cgoPreambleOf(file); ok {
+			if err := m.cgo.add(m.Fset.Position(file.Pos()).Filename, preamble); err != nil {
+				return err
+			}
+			if preamble != nil {
+				m.dropped[preamble] = true
+			}
+		}
+		selected = append(selected, file)
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+	b, err := joinFiles(selected)
+	if err != nil {
+		return err
+	}
+	originals := map[string]string{}
+	if prefix != "" {
+		originals = prefixDeclarations(m.Fset, b, prefix)
+	}
 	bDeclares := findDeclarations(b)
 
 	// handle imports
 	imps, err := findImports(b)
 	if err != nil {
-		return nil
+		return err
 	}
-	for name, iPath := range imps {
+	for _, imp := range imps {
+		name, iPath := imp.name, m.rewriteImport(imp.path)
+		impDecision := Decision{Name: name, Kind: "import", Pos: m.Fset.Position(imp.spec.Pos()), Path: imp.path}
+		if iPath != imp.path {
+			impDecision.NewPath = iPath
+		}
 
-		if len(m.imports) == 0 {
-			// add imports to the file ...
-			m.File.Decls = append(m.File.Decls, &m.importsDecl)
+		if m.isPackage(iPath) {
+			// the package is merged too ... refer to its declarations directly
+			m.findReferences(b, name, iPath)
+			impDecision.Outcome, impDecision.Reason = OutcomeImportMerged, "the package is merged too"
+			m.addDecision(impDecision)
+			continue
+		}
+
+		if reason, ok := m.Options.ImportPolicy.Check(iPath); !ok {
+			m.violations = append(m.violations, ImportViolation{
+				File:   m.Fset.Position(imp.spec.Pos()).Filename,
+				Decls:  importUsers(b, name),
+				Path:   iPath,
+				Reason: reason,
+			})
+			continue
+		}
+
+		if iPath == "C" {
+			// the pseudo package of cgo is written together with the
+			// merged preamble. C.xxx references are never renamed.
+			m.cgo.used = true
+			impDecision.Outcome, impDecision.Reason = OutcomeKept, "written together with the cgo preamble"
+			m.addDecision(impDecision)
+			continue
 		}
 
+		if name == "_" || name == "." {
+			// blank and dot imports don't declare a name which could conflict
+			if !m.unnamedImports[name+iPath] {
+				m.unnamedImports[name+iPath] = true
+				m.addImport(name, iPath)
+				impDecision.Outcome = OutcomeKept
+			} else {
+				impDecision.Outcome = OutcomeDeduped
+				impDecision.Reason = "already imported as " + strconv.Quote(iPath)
+			}
+			m.addDecision(impDecision)
+			continue
+		}
+
+		obj := resolveQualifier(b, name, iPath)
 		mImportPath := m.imports[name]
 		if iPath == mImportPath {
+			impDecision.Outcome = OutcomeDeduped
+			impDecision.Reason = "already imported as " + strconv.Quote(iPath)
+			m.addDecision(impDecision)
 			continue
 		}
 
+		if mName, ok := m.importNames[iPath]; ok {
+			if !identUsed(b, mName) {
+				// same package, but imported with a different name ... the
+				// qualifiers get the already known name, so that one import is enough
+				m.emit(ImportResolved{Path: iPath, Name: name, ExistingName: mName})
+				renameQualifier(b, obj, mName)
+				impDecision.NewName, impDecision.Outcome = mName, OutcomeImportAliased
+				impDecision.Reason = fmt.Sprintf("%q is already imported as %v", iPath, mName)
+				m.addDecision(impDecision)
+				continue
+			}
+			// the known name is declared by the file too, e.g. by a local ...
+			// the qualifiers would refer to it, so the package is imported again
+			m.emit(ImportDuplicated{Path: iPath, Name: name, ExistingName: mName})
+			impDecision.Reason = fmt.Sprintf("%q is already imported as %v, which is used otherwise by the file", iPath, mName)
+		}
+
 		if mImportPath != "" {
 			newName := name + duplicatePostfix
-			log.Printf("import name conflict %q with paths %q != %q", name, iPath, mImportPath)
-			log.Printf("rename %q -> %q", name, newName)
-			RenameDeclarations(b, name, newName)
+			for i := 2; m.imports[newName] != "" || identUsed(b, newName); i++ {
+				newName = name + duplicatePostfix + strconv.Itoa(i)
+			}
+			m.emit(ImportConflict{Name: name, Path: iPath, ExistingPath: mImportPath, NewName: newName})
+			renameQualifier(b, obj, newName)
+			impDecision.NewName, impDecision.Outcome = newName, OutcomeImportAliased
+			impDecision.Reason = fmt.Sprintf("name conflicts with the import of %q", mImportPath)
 			name = newName
+		} else {
+			impDecision.Outcome = OutcomeKept
 		}
-
-		var impSpecName *ast.Ident
-		if path.Base(iPath) != name {
-			impSpecName = &ast.Ident{Name: name}
-		}
-
-		impSpec := &ast.ImportSpec{
-			Name: impSpecName,
-			Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(iPath)},
-		}
+		m.addDecision(impDecision)
 
 		m.imports[name] = iPath
-		m.importsDecl.Specs = append(m.importsDecl.Specs, impSpec)
-		m.File.Imports = append(m.File.Imports, impSpec)
+		if _, ok := m.importNames[iPath]; !ok {
+			m.importNames[iPath] = name
+		}
+		m.addImport(name, iPath)
 	}
 	RemoveImports(b)
+	m.comments = append(m.comments, b.Comments...)
 
 	// find and remove duplicate declarations
-	for name, dec := range bDeclares {
+	renames := map[string]string{}
+	for _, declare := range bDeclares {
+		if err := m.ctxErr(); err != nil {
+			return err
+		}
+		name, dec := declare.name, declare.node
+		original := declare.name
+		if o, ok := originals[original]; ok {
+			original = o
+		}
+		if funcDecl, ok := dec.(*ast.FuncDecl); ok {
+			// the receiver type could have been renamed
+			name = funcName(funcDecl)
+		}
+		pos := m.Fset.Position(declare.pos)
+		decision := Decision{Name: original, NewName: name, Kind: declare.kind, Pos: pos}
+		if name == "init" || name == "_" {
+			// can be declared multiple times
+			m.unnamedOrigins[declare.pos] = &Origin{Name: name, Pos: pos}
+			decision.Outcome, decision.Reason = OutcomeKept, "can be declared multiple times"
+			m.addDecision(decision)
+			continue
+		}
 		dup := m.declares[name]
 		if dup == nil {
 			m.declares[name] = dec
+			m.setIota(name, declare.iota)
+			m.addOrigin(name, original, pos)
+			decision.Outcome = OutcomeKept
+			m.addDecision(decision)
 			continue
 		}
-		if err := NodeEqual(dup, dec); err != nil {
+		decision.Existing = m.existing(name)
+		err := NodeEqual(dup, dec)
+		if iota, ok := m.iotas[name]; err == nil && (ok || declare.iota >= 0) && iota != declare.iota {
+			// the same expression, but iota has another value
+			err = fmt.Errorf("iota %v != %v", iota, declare.iota)
+		}
+		if err != nil {
 			// ups ... name conflict
 			if additional, ok := err.(ErrAdditionalFields); ok {
 				// however ... just additional fields ... we can merge them
+				decision.Outcome, decision.Mismatch = OutcomeDeduped, err.Error()
+				decision.Reason = "the merged struct has all fields"
 				if len(additional.B) > 0 {
-					log.Printf("add additional fields (%v) to %v", strings.Join(additional.B, ","), name)
-					err = mergeFields(dup.(*ast.StructType), dec.(*ast.StructType), additional.B)
+					m.emit(FieldsMerged{Struct: name, Fields: additional.B})
+					err = m.mergeFields(dup.(*ast.StructType), dec.(*ast.StructType), additional.B, name)
 					if err != nil {
 						return err
 					}
+					decision.Outcome, decision.Fields = OutcomeFieldsMerged, additional.B
+					decision.Reason = "struct with additional fields"
 				}
-				b.Decls = RemoveDeclByName(b.Decls, name)
-				log.Printf("removed duplicate %q", name)
+				m.removeDecl(b, name)
+				m.addDuplicate(name, pos, dec)
+				m.emit(Dedup{Name: name})
 			} else {
 				newName := name + duplicatePostfix
-				log.Printf("name conflict of declaration %q: %v", name, err)
-				log.Printf("rename %q -> %q", name, newName)
+				m.emit(Rename{Name: name, NewName: newName, Mismatch: err.Error()})
 				RenameDeclarations(b, name, newName)
+				renameDocs(b, name, newName)
+				renameLinknames(b, name, newName)
+				renames[original] = newName
 				m.declares[newName] = dec
+				m.setIota(newName, declare.iota)
+				m.addOrigin(newName, original, pos)
+				decision.NewName, decision.Outcome, decision.Mismatch = newName, OutcomeRenamed, err.Error()
+				decision.Reason = "name conflict"
 			}
 		} else {
 			// remove instance of duplicate declaration
-			b.Decls = RemoveDeclByName(b.Decls, name)
-			log.Printf("removed duplicate %q", name)
+			m.removeDecl(b, name)
+			m.addDuplicate(name, pos, dec)
+			m.emit(Dedup{Name: name})
+			decision.Outcome, decision.Reason = OutcomeDeduped, "identical declaration"
 		}
+		m.addDecision(decision)
 	}
 	m.File.Decls = append(m.File.Decls, b.Decls...)
+	// an import of b can become unused, if the declarations using it were duplicates
+	m.removeUnusedImports()
 
-	return nil
+	if importPath != "" {
+		for prefixed, original := range originals {
+			if _, renamed := renames[original]; !renamed {
+				renames[original] = prefixed
+			}
+		}
+		m.renames[importPath] = renames
+	}
+	return m.resolveReferences()
 }
 
-func findDeclarations(file *ast.File) map[string]ast.Node {
-	declares := map[string]ast.Node{}
+// addImport adds an import to the merged file
+func (m *Merger) addImport(name, iPath string) {
+	if len(m.importsDecl.Specs) == 0 {
+		// add imports to the file ...
+		m.File.Decls = append(m.File.Decls, &m.importsDecl)
+	}
+
+	var impSpecName *ast.Ident
+	if path.Base(iPath) != name {
+		impSpecName = &ast.Ident{Name: name}
+	}
+
+	impSpec := &ast.ImportSpec{
+		Name: impSpecName,
+		Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(iPath)},
+	}
+
+	m.importsDecl.Specs = append(m.importsDecl.Specs, impSpec)
+	m.File.Imports = append(m.File.Imports, impSpec)
+}
 
-	ast.Inspect(file, func(n ast.Node) bool {
-		if _, isStmtBlock := n.(*ast.BlockStmt); isStmtBlock {
-			// don't check for things which are declared in a func
-			return false
+// rewriteImport applies the import rewrite rule with the
+// longest matching prefix to the given path.
+func (m *Merger) rewriteImport(iPath string) string {
+	var rule *ImportRewrite
+	for i, r := range m.Options.ImportRewrites {
+		if _, ok := r.Rewrite(iPath); ok && (rule == nil || len(r.Old) > len(rule.Old)) {
+			rule = &m.Options.ImportRewrites[i]
 		}
-		if typeSpec, ok := n.(*ast.TypeSpec); ok {
-			declares[typeSpec.Name.Name] = typeSpec.Type
-			return false
+	}
+	if rule == nil {
+		return iPath
+	}
+	newPath, _ := rule.Rewrite(iPath)
+	m.emit(ImportRewritten{Path: iPath, NewPath: newPath})
+	m.usedRewrites[*rule] = true
+	return newPath
+}
+
+// UnusedImportRewrites returns all import rewrite rules
+// which didn't match any import so far.
+func (m *Merger) UnusedImportRewrites() []ImportRewrite {
+	unused := []ImportRewrite{}
+	for _, r := range m.Options.ImportRewrites {
+		if !m.usedRewrites[r] {
+			unused = append(unused, r)
 		}
-		if valSpec, ok := n.(*ast.ValueSpec); ok {
-			for i, name := range valSpec.Names {
-				declares[name.Name] = &ast.ValueSpec{
-					Names:  []*ast.Ident{name},
-					Type:   valSpec.Type,
-					Values: []ast.Expr{valSpec.Values[i]},
+	}
+	return unused
+}
+
+// declaration is a package level declaration of a file
+type declaration struct {
+	name string
+	node ast.Node
+	pos  token.Pos
+	// kind is func, method, type, var or const
+	kind string
+	// iota is the index of a constant in its group, if its value
+	// depends on iota, otherwise it is -1
+	iota int
+}
+
+// setIota records the iota index of a declared constant
+func (m *Merger) setIota(name string, iota int) {
+	if iota >= 0 {
+		m.iotas[name] = iota
+	} else {
+		delete(m.iotas, name)
+	}
+}
+
+// findDeclarations finds all package level declarations in source order.
+// Methods are returned after all other declarations, because they
+// depend on the declaration of their receiver type.
+func findDeclarations(file *ast.File) []declaration {
+	declares := []declaration{}
+	methods := []declaration{}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv != nil {
+				methods = append(methods, declaration{funcName(decl), decl, decl.Name.Pos(), "method", -1})
+			} else {
+				declares = append(declares, declaration{funcName(decl), decl, decl.Name.Pos(), "func", -1})
+			}
+		case *ast.GenDecl:
+			// constants without values repeat the type and values of the previous spec
+			var typ ast.Expr
+			var previous []ast.Expr
+			for index, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					declares = append(declares, declaration{spec.Name.Name, spec.Type, spec.Name.Pos(), "type", -1})
+				case *ast.ValueSpec:
+					specType, specValues := spec.Type, spec.Values
+					if decl.Tok == token.CONST {
+						if len(specValues) == 0 {
+							specType, specValues = typ, previous
+						}
+						typ, previous = specType, specValues
+					}
+					iota := -1
+					if decl.Tok == token.CONST && identUsed(&ast.ValueSpec{Values: specValues}, "iota") {
+						iota = index
+					}
+					for i, name := range spec.Names {
+						values := specValues
+						if len(values) == len(spec.Names) {
+							values = []ast.Expr{specValues[i]}
+						}
+						declares = append(declares, declaration{name.Name, &ast.ValueSpec{
+							Names:  []*ast.Ident{name},
+							Type:   specType,
+							Values: values,
+						}, name.Pos(), decl.Tok.String(), iota})
+					}
 				}
 			}
-			return false
-		}
-		if funcDecl, ok := n.(*ast.FuncDecl); ok {
-			declares[funcName(funcDecl)] = funcDecl
-			return false
 		}
-		return true
-	})
+	}
 
-	return declares
+	return append(declares, methods...)
 }
 
-func findImports(file *ast.File) (map[string]string, error) {
-	imports := map[string]string{}
+// importSpec is an import with its resolved name
+type importSpec struct {
+	name string
+	path string
+	spec *ast.ImportSpec
+}
+
+func findImports(file *ast.File) ([]importSpec, error) {
+	imports := []importSpec{}
 	for _, impSpec := range file.Imports {
 		impName := ""
 		impPath, err := strconv.Unquote(impSpec.Path.Value)
@@ -163,18 +519,45 @@ func findImports(file *ast.File) (map[string]string, error) {
 			impName = path.Base(impPath)
 		}
 
-		imports[impName] = impPath
+		imports = append(imports, importSpec{impName, impPath, impSpec})
 	}
 	return imports, nil
 }
 
-func mergeFields(a, b *ast.StructType, fields []string) error {
-	bFields, err := FieldListToMap(b.Fields)
-	if err != nil {
-		return err
+// identUsed checks whether an identifier with the given name
+// exists anywhere in the given node.
+func identUsed(node ast.Node, name string) bool {
+	used := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == name {
+			used = true
+		}
+		return !used
+	})
+	return used
+}
+
+// mergeFields adds the given fields of b to the struct a. The fields keep
+// the positions and comments of b, so they are printed separately
+// at the end of the struct, see printDecl.
+func (m *Merger) mergeFields(a, b *ast.StructType, fields []string, structName string) error {
+	bFields := map[string]*ast.Field{}
+	for _, f := range b.Fields.List {
+		for _, n := range f.Names {
+			bFields[n.Name] = f
+		}
 	}
 	for _, name := range fields {
-		a.Fields.List = append(a.Fields.List, bFields[name].ToAstField())
+		f := bFields[name]
+		if f == nil {
+			return fmt.Errorf("field %v of struct %v not found", name, structName)
+		}
+		pos := m.Fset.Position(f.Pos())
+		m.addFieldOrigin(structName, name, pos)
+		// a field can declare multiple names, only this one is merged
+		field := &ast.Field{Doc: f.Doc, Names: []*ast.Ident{ast.NewIdent(name)}, Type: f.Type, Tag: f.Tag, Comment: f.Comment}
+		a.Fields.List = append(a.Fields.List, field)
+		m.mergedFields[a] = append(m.mergedFields[a], mergedField{field: field, pos: pos})
 	}
 	return nil
 }
@@ -0,0 +1,41 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// noImporter doesn't import any package. Type checks with it only
+// resolve the objects declared by the checked files themselves.
+type noImporter struct{}
+
+func (noImporter) Import(path string) (*types.Package, error) {
+	return nil, fmt.Errorf("package %q isn't imported", path)
+}
+
+// packageIdents type checks the file and returns the identifiers, which declare
+// or use the package level objects of the file, by the name of the object.
+// Locals, fields and keys of composite literals with the same name are not
+// part of it. Type errors, e.g. of the imports which aren't resolved, are
+// ignored, because only the identity of the package level objects matters.
+func packageIdents(fset *token.FileSet, file *ast.File) map[string][]*ast.Ident {
+	info := &types.Info{Defs: map[*ast.Ident]types.Object{}, Uses: map[*ast.Ident]types.Object{}}
+	conf := types.Config{Importer: noImporter{}, FakeImportC: true, Error: func(error) {}}
+	pkg, _ := conf.Check(file.Name.Name, fset, []*ast.File{file}, info)
+
+	idents := map[string][]*ast.Ident{}
+	add := func(ident *ast.Ident, obj types.Object) {
+		if obj != nil && obj.Parent() == pkg.Scope() {
+			idents[obj.Name()] = append(idents[obj.Name()], ident)
+		}
+	}
+	for ident, obj := range info.Defs {
+		add(ident, obj)
+	}
+	for ident, obj := range info.Uses {
+		add(ident, obj)
+	}
+	return idents
+}
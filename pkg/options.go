@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Options changes the behaviour of a Merger.
+type Options struct {
+	// ImportRewrites are applied to the import paths of every merged file,
+	// before import conflicts are resolved.
+	ImportRewrites []ImportRewrite `json:"importRewrites,omitempty"`
+
+	// ImportPolicy restricts what the merged file may import.
+	ImportPolicy ImportPolicy `json:"importPolicy"`
+
+	// Provenance annotates each declaration of the merged file
+	// with the position of its source.
+	Provenance bool `json:"provenance,omitempty"`
+
+	// LineDirectives adds a //line directive before each declaration,
+	// so that compiler errors and stack traces refer to the source files.
+	LineDirectives bool `json:"lineDirectives,omitempty"`
+
+	// Order of the declarations in the merged file
+	Order DeclOrder `json:"order,omitempty"`
+
+	// Constraints defines how build constraints are handled
+	Constraints ConstraintMode `json:"constraints,omitempty"`
+
+	// GOOS, GOARCH and Tags are the target of ConstraintSelect.
+	// If empty, the GOOS and GOARCH of the running program are used.
+	GOOS   string   `json:"goos,omitempty"`
+	GOARCH string   `json:"goarch,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// ImportRewrite replaces the import path prefix Old with New.
+type ImportRewrite struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// ParseImportRewrite parses a rewrite rule of the form "old=new".
+func ParseImportRewrite(rule string) (ImportRewrite, error) {
+	old, new, ok := strings.Cut(rule, "=")
+	if !ok || old == "" || new == "" {
+		return ImportRewrite{}, fmt.Errorf("invalid import rewrite %q, expected old=new", rule)
+	}
+	return ImportRewrite{Old: old, New: new}, nil
+}
+
+func (r ImportRewrite) String() string {
+	return r.Old + "=" + r.New
+}
+
+// Rewrite applies the rule to the given import path. The prefix
+// must match whole path elements.
+func (r ImportRewrite) Rewrite(iPath string) (string, bool) {
+	if iPath == r.Old {
+		return r.New, true
+	}
+	if strings.HasPrefix(iPath, r.Old+"/") {
+		return r.New + iPath[len(r.Old):], true
+	}
+	return iPath, false
+}
@@ -0,0 +1,238 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// DeclOrder defines how the declarations of a merged file are ordered.
+type DeclOrder string
+
+const (
+	// OrderSource keeps the order of the source files
+	OrderSource DeclOrder = "source"
+	// OrderKind groups consts, vars, types and funcs
+	OrderKind DeclOrder = "kind"
+	// OrderType groups each type with its constructors and methods
+	OrderType DeclOrder = "type"
+	// OrderAlpha orders alphabetically by the declared name
+	OrderAlpha DeclOrder = "alpha"
+	// OrderDependency orders declarations before their usage
+	OrderDependency DeclOrder = "dependency"
+)
+
+// ParseDeclOrder parses the name of an order. An empty name is the source order.
+func ParseDeclOrder(order string) (DeclOrder, error) {
+	switch o := DeclOrder(order); o {
+	case "":
+		return OrderSource, nil
+	case OrderSource, OrderKind, OrderType, OrderAlpha, OrderDependency:
+		return o, nil
+	}
+	return "", fmt.Errorf("unknown declaration order %q", order)
+}
+
+// OrderDecls orders the given declarations. Imports are always first
+// and declarations which are equal for the given order keep the source order.
+func OrderDecls(decls []ast.Decl, order DeclOrder) ([]ast.Decl, error) {
+	imports := []ast.Decl{}
+	others := []ast.Decl{}
+	for _, decl := range decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+			imports = append(imports, decl)
+		} else {
+			others = append(others, decl)
+		}
+	}
+
+	switch order {
+	case "", OrderSource:
+	case OrderKind:
+		sort.SliceStable(others, func(i, j int) bool {
+			return declKind(others[i]) < declKind(others[j])
+		})
+	case OrderType:
+		others = orderByType(others)
+	case OrderAlpha:
+		sort.SliceStable(others, func(i, j int) bool {
+			return declSortName(others[i]) < declSortName(others[j])
+		})
+	case OrderDependency:
+		others = orderByDependency(others)
+	default:
+		return nil, fmt.Errorf("unknown declaration order %q", order)
+	}
+
+	return append(imports, others...), nil
+}
+
+// declKind returns the rank of a declaration for OrderKind
+func declKind(decl ast.Decl) int {
+	if genDecl, ok := decl.(*ast.GenDecl); ok {
+		switch genDecl.Tok {
+		case token.CONST:
+			return 0
+		case token.VAR:
+			return 1
+		case token.TYPE:
+			return 2
+		}
+	}
+	return 3
+}
+
+// declSortName returns the name which is used for OrderAlpha
+func declSortName(decl ast.Decl) string {
+	names := declNames(decl)
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(names[0], "*")
+}
+
+// orderByType orders consts, vars and funcs first, followed
+// by each type with its constructors and methods.
+func orderByType(decls []ast.Decl) []ast.Decl {
+	types := []string{}
+	typeDecls := map[string][]ast.Decl{}
+	constructors := map[string][]ast.Decl{}
+	methods := map[string][]ast.Decl{}
+	others := []ast.Decl{}
+
+	for _, decl := range decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+			names := declNames(decl)
+			if len(names) > 0 {
+				types = append(types, names...)
+				for _, name := range names {
+					typeDecls[name] = append(typeDecls[name], decl)
+				}
+				continue
+			}
+		}
+		others = append(others, decl)
+	}
+
+	isType := map[string]bool{}
+	for _, name := range types {
+		isType[name] = true
+	}
+
+	ordered := []ast.Decl{}
+	for _, decl := range others {
+		if owner := declOwner(decl, isType); owner == "" {
+			ordered = append(ordered, decl)
+		} else if decl.(*ast.FuncDecl).Recv == nil {
+			constructors[owner] = append(constructors[owner], decl)
+		} else {
+			methods[owner] = append(methods[owner], decl)
+		}
+	}
+	// a grouped type decl is written with the first of its types
+	written := map[ast.Decl]bool{}
+	for _, name := range types {
+		for _, decl := range typeDecls[name] {
+			if !written[decl] {
+				written[decl] = true
+				ordered = append(ordered, decl)
+			}
+		}
+		ordered = append(ordered, constructors[name]...)
+		ordered = append(ordered, methods[name]...)
+	}
+	return ordered
+}
+
+// declOwner returns the type a func belongs to. This is the receiver
+// type of a method or the first result type of a constructor.
+func declOwner(decl ast.Decl, isType map[string]bool) string {
+	funcDecl, ok := decl.(*ast.FuncDecl)
+	if !ok {
+		return ""
+	}
+	if funcDecl.Recv != nil {
+		return typeName(funcDecl.Recv.List[0].Type)
+	}
+	if funcDecl.Type.Results == nil {
+		return ""
+	}
+	for _, result := range funcDecl.Type.Results.List {
+		if name := typeName(result.Type); isType[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+// typeName returns the name of a (pointer to a) named type
+func typeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return typeName(t.X)
+	case *ast.IndexExpr:
+		return typeName(t.X)
+	case *ast.IndexListExpr:
+		return typeName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// orderByDependency orders declarations topologically, so that
+// a declaration appears before its usage. Cyclic dependencies
+// keep the source order.
+func orderByDependency(decls []ast.Decl) []ast.Decl {
+	declaredBy := map[string]int{}
+	for i, decl := range decls {
+		for _, name := range declNames(decl) {
+			declaredBy[name] = i
+		}
+	}
+
+	dependencies := make([]map[int]bool, len(decls))
+	for i, decl := range decls {
+		dependencies[i] = map[int]bool{}
+		for ref := range declRefs(decl) {
+			if dep, ok := declaredBy[ref]; ok && dep != i {
+				dependencies[i][dep] = true
+			}
+		}
+	}
+
+	ordered := make([]ast.Decl, 0, len(decls))
+	done := make([]bool, len(decls))
+	for len(ordered) < len(decls) {
+		next := -1
+		for i := range decls {
+			if !done[i] && dependenciesDone(dependencies[i], done) {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			// cyclic dependency ... just take the first remaining one
+			for i := range decls {
+				if !done[i] {
+					next = i
+					break
+				}
+			}
+		}
+		done[next] = true
+		ordered = append(ordered, decls[next])
+	}
+	return ordered
+}
+
+func dependenciesDone(dependencies map[int]bool, done []bool) bool {
+	for dep := range dependencies {
+		if !done[dep] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"path"
+	"strconv"
+)
+
+// joinFiles joins the files of a package into a single file. Imports are
+// file scoped ... if files import different packages with the same name,
+// the import and its qualifiers get renamed in the later file.
+func joinFiles(files []*ast.File) (*ast.File, error) {
+	if len(files) == 1 {
+		return files[0], nil
+	}
+
+	joined := &ast.File{
+		Package: files[0].Package,
+		Name:    files[0].Name,
+	}
+	imports := map[string]string{}
+	for _, file := range files {
+		if file.Name.Name != joined.Name.Name {
+			return nil, fmt.Errorf("files of package %q and %q can't be joined", joined.Name.Name, file.Name.Name)
+		}
+		for _, impSpec := range file.Imports {
+			iPath, err := strconv.Unquote(impSpec.Path.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid import path %v", err)
+			}
+			name := path.Base(iPath)
+			if impSpec.Name != nil {
+				name = impSpec.Name.Name
+			}
+			if name == "_" || name == "." || iPath == "C" {
+				continue
+			}
+			if mPath, exists := imports[name]; exists && mPath != iPath {
+				newName := name
+				for i := 2; imports[newName] != "" || identUsed(file, newName); i++ {
+					newName = name + strconv.Itoa(i)
+				}
+				renameQualifier(file, resolveQualifier(file, name, iPath), newName)
+				impSpec.Name = &ast.Ident{NamePos: impSpec.Path.Pos(), Name: newName}
+				name = newName
+			}
+			imports[name] = iPath
+		}
+		joined.Decls = append(joined.Decls, file.Decls...)
+		joined.Imports = append(joined.Imports, file.Imports...)
+		joined.Comments = append(joined.Comments, file.Comments...)
+	}
+	return joined, nil
+}
@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// ImportPolicy restricts the imports of the merged file.
+type ImportPolicy struct {
+	// Allow contains the allowed import paths or path prefixes.
+	// The entry "std" allows all packages of the standard library.
+	// If empty, every import is allowed which isn't denied.
+	Allow []string `json:"allow,omitempty"`
+
+	// Deny contains forbidden import paths or path prefixes, e.g. "unsafe" or "C".
+	Deny []string `json:"deny,omitempty"`
+}
+
+// ImportViolation is an import which violates the import policy.
+type ImportViolation struct {
+	File   string
+	Decls  []string
+	Path   string
+	Reason string
+}
+
+func (v ImportViolation) String() string {
+	by := "imported"
+	if len(v.Decls) > 0 {
+		by = "used by " + strings.Join(v.Decls, ",")
+	}
+	return fmt.Sprintf("%v: import %q %v: %v", v.File, v.Path, by, v.Reason)
+}
+
+// ErrImportPolicy if imports violate the import policy
+type ErrImportPolicy struct {
+	Violations []ImportViolation
+}
+
+func (e ErrImportPolicy) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.String()
+	}
+	return "import policy violated:\n" + strings.Join(violations, "\n")
+}
+
+// ImportPolicyErr returns an ErrImportPolicy with the violations of all
+// files merged so far, or nil if no import violates the import policy.
+func (m *Merger) ImportPolicyErr() error {
+	if len(m.violations) == 0 {
+		return nil
+	}
+	return ErrImportPolicy{Violations: append([]ImportViolation{}, m.violations...)}
+}
+
+// Check checks whether the given import path is allowed. If not,
+// the reason gets returned.
+func (p ImportPolicy) Check(iPath string) (string, bool) {
+	for _, deny := range p.Deny {
+		if pathHasPrefix(iPath, deny) {
+			return fmt.Sprintf("denied by %q", deny), false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return "", true
+	}
+	for _, allow := range p.Allow {
+		if allow == "std" && IsStdImport(iPath) || pathHasPrefix(iPath, allow) {
+			return "", true
+		}
+	}
+	return "not allowed", false
+}
+
+// IsStdImport checks whether the import path belongs to the standard library.
+func IsStdImport(iPath string) bool {
+	if iPath == "C" {
+		// cgo is no package at all
+		return false
+	}
+	first, _, _ := strings.Cut(iPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+// pathHasPrefix checks whether prefix matches whole path elements of the import path.
+func pathHasPrefix(iPath, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return iPath == prefix || strings.HasPrefix(iPath, prefix+"/")
+}
+
+// importUsers finds the names of all declarations which
+// use the import with the given name.
+func importUsers(file *ast.File, name string) []string {
+	users := []string{}
+	for _, decl := range file.Decls {
+		used := false
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok && ident.Name == name {
+					used = true
+				}
+			}
+			return !used
+		})
+		if used {
+			users = append(users, declNames(decl)...)
+		}
+	}
+	return users
+}
@@ -0,0 +1,421 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// mergeHeader adds the header comments and, if docs is set, the package
+// documentation of a file to the header of the merged file.
+func (m *Merger) mergeHeader(b *ast.File, docs bool) {
+	for _, c := range headerComments(b) {
+		m.header = appendUnique(m.header, commentText(c))
+	}
+	if b.Doc != nil && docs {
+		m.docs = appendUnique(m.docs, commentText(b.Doc))
+	}
+}
+
+// removeDecl removes a declaration of b. The comments of the declaration
+// are removed too, so that they don't show up in a declaration group anymore.
+func (m *Merger) removeDecl(b *ast.File, name string) {
+	for _, c := range specComments(b.Decls, name) {
+		m.dropped[c] = true
+	}
+	b.Decls = RemoveDeclByName(b.Decls, name)
+	moveLparen(m.Fset, b.Decls)
+}
+
+// moveLparen moves the parenthesis of groups to their first spec. If the first
+// spec of a group was removed, the group would start with empty lines otherwise.
+func moveLparen(fset *token.FileSet, decls []ast.Decl) {
+	for _, decl := range decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || !genDecl.Lparen.IsValid() || len(genDecl.Specs) == 0 {
+			continue
+		}
+		first := specPos(genDecl.Specs[0])
+		file := fset.File(first)
+		if file == nil || file != fset.File(genDecl.Lparen) {
+			// the positions aren't part of the file set
+			continue
+		}
+		if line := file.Line(first); line-file.Line(genDecl.Lparen) > 1 {
+			genDecl.Lparen = file.LineStart(line) - 1
+		}
+	}
+}
+
+// specPos returns the start of a spec, including its documentation.
+func specPos(spec ast.Spec) token.Pos {
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		if spec.Doc != nil {
+			return spec.Doc.Pos()
+		}
+	case *ast.ValueSpec:
+		if spec.Doc != nil {
+			return spec.Doc.Pos()
+		}
+	}
+	return spec.Pos()
+}
+
+// sortedComments returns all comments of the merged declarations
+// ordered by their position.
+func (m *Merger) sortedComments() []*ast.CommentGroup {
+	comments := make([]*ast.CommentGroup, 0, len(m.comments))
+	for _, c := range m.comments {
+		if !m.dropped[c] {
+			comments = append(comments, c)
+		}
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].Pos() < comments[j].Pos()
+	})
+	return comments
+}
+
+// Format prints the merged file with all comments of the merged declarations.
+// It fails, if imports of any merged file violate the import policy
+// or references to a merged package can't be resolved.
+// The declarations are ordered by Options.Order first.
+func (m *Merger) Format() ([]byte, error) {
+	if err := m.ImportPolicyErr(); err != nil {
+		return nil, err
+	}
+	if err := m.unresolvedReferences(); err != nil {
+		return nil, err
+	}
+	var err error
+	if m.File.Decls, err = OrderDecls(m.File.Decls, m.Options.Order); err != nil {
+		return nil, err
+	}
+	src := &bytes.Buffer{}
+
+	if m.Header != "" {
+		src.WriteString(m.Header)
+		src.WriteString("\n\n")
+	}
+	if m.constraint != nil {
+		src.WriteString("//go:build ")
+		src.WriteString(m.constraint.String())
+		src.WriteString("\n\n")
+	}
+	for _, header := range m.header {
+		src.WriteString(header)
+		src.WriteString("\n\n")
+	}
+	if len(m.docs) > 0 {
+		src.WriteString(strings.Join(m.docs, "\n//\n"))
+		src.WriteString("\n")
+	}
+	src.WriteString("package ")
+	src.WriteString(m.File.Name.Name)
+	src.WriteString("\n")
+	if len(m.generate) > 0 {
+		src.WriteString("\n")
+		src.WriteString(strings.Join(m.generate, "\n"))
+		src.WriteString("\n")
+	}
+	if m.cgo.used {
+		src.WriteString("\n")
+		if preamble := m.cgo.String(); preamble != "" {
+			src.WriteString(preamble)
+			src.WriteString("\n")
+		}
+		src.WriteString("import \"C\"\n")
+	}
+
+	comments := m.sortedComments()
+	// the floating comments are written before the next declaration of their
+	// file, the comments at the end of a file after its last declaration
+	floating := map[*ast.CommentGroup]bool{}
+	lastDecls := map[*token.File]ast.Decl{}
+	for _, decl := range m.File.Decls {
+		if pos := declPos(decl); pos.IsValid() {
+			lastDecls[m.Fset.File(pos)] = decl
+		}
+	}
+	writeFloating := func(file *token.File, before token.Pos) {
+		for _, c := range m.floating {
+			if !floating[c] && (!before.IsValid() || c.Pos() < before) && m.Fset.File(c.Pos()) == file {
+				floating[c] = true
+				src.WriteString("\n")
+				src.WriteString(commentText(c))
+				src.WriteString("\n")
+			}
+		}
+	}
+	for _, decl := range m.File.Decls {
+		if err := m.ctxErr(); err != nil {
+			return nil, err
+		}
+		var file *token.File
+		if pos := declPos(decl); pos.IsValid() {
+			file = m.Fset.File(pos)
+			writeFloating(file, pos)
+		}
+		src.WriteString("\n")
+		if m.Options.Provenance {
+			if provenance := m.provenance(decl); provenance != "" {
+				src.WriteString(provenance)
+				src.WriteString("\n")
+			}
+		}
+		if m.Options.LineDirectives && decl.Pos().IsValid() {
+			// a directive is moved to the end of the doc comment
+			// by gofmt ... so it must map the line of the declaration
+			src.WriteString(lineDirective(m.relPosition(m.Fset.Position(decl.Pos()))))
+			src.WriteString("\n")
+		}
+		text := &bytes.Buffer{}
+		if err := m.printDecl(text, decl, comments); err != nil {
+			return nil, err
+		}
+		out := text.Bytes()
+		if m.Options.LineDirectives {
+			var err error
+			if out, err = m.nodeDirectives(decl, out); err != nil {
+				return nil, err
+			}
+		}
+		src.Write(out)
+		src.WriteString("\n")
+		if file != nil && lastDecls[file] == decl {
+			writeFloating(file, token.NoPos)
+		}
+	}
+
+	return format.Source(src.Bytes())
+}
+
+// mergedField is a field, which was added to a struct of the merged file
+type mergedField struct {
+	field *ast.Field
+	// pos of the field in its source file
+	pos token.Position
+}
+
+// printDecl prints a declaration with its comments. The merged fields of
+// its structs have positions of other files, so they are printed separately
+// and inserted before the closing brace of their struct.
+func (m *Merger) printDecl(w io.Writer, decl ast.Decl, comments []*ast.CommentGroup) error {
+	if !decl.Pos().IsValid() {
+		return printerConfig.Fprint(w, m.Fset, decl)
+	}
+	node := &printer.CommentedNode{Node: decl, Comments: comments}
+
+	structs := []*ast.StructType{}
+	ast.Inspect(decl, func(n ast.Node) bool {
+		if st, ok := n.(*ast.StructType); ok {
+			structs = append(structs, st)
+		}
+		return true
+	})
+	merged := false
+	for _, st := range structs {
+		if fields := m.mergedFields[st]; len(fields) > 0 {
+			// the merged fields are always at the end of the struct
+			defer func(st *ast.StructType, all []*ast.Field) { st.Fields.List = all }(st, st.Fields.List)
+			st.Fields.List = st.Fields.List[:len(st.Fields.List)-len(fields)]
+			merged = true
+		}
+	}
+	if !merged {
+		return printerConfig.Fprint(w, m.Fset, node)
+	}
+
+	src := &bytes.Buffer{}
+	src.WriteString("package p\n\n")
+	if err := printerConfig.Fprint(src, m.Fset, node); err != nil {
+		return err
+	}
+	// the printed structs are found in the same order
+	// to get the offsets of their closing braces
+	fset := token.NewFileSet()
+	printed, err := parser.ParseFile(fset, "", src.Bytes(), parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	closings := []int{}
+	ast.Inspect(printed, func(n ast.Node) bool {
+		if st, ok := n.(*ast.StructType); ok {
+			closings = append(closings, fset.Position(st.Fields.Closing).Offset)
+		}
+		return true
+	})
+	if len(closings) != len(structs) {
+		return fmt.Errorf("printed declaration has %v structs instead of %v", len(closings), len(structs))
+	}
+
+	out := src.Bytes()
+	for i := len(structs) - 1; i >= 0; i-- {
+		fields := m.mergedFields[structs[i]]
+		if len(fields) == 0 {
+			continue
+		}
+		text := &bytes.Buffer{}
+		closing := closings[i]
+		if out[closing-1] != '\n' {
+			text.WriteString("\n")
+		}
+		for _, f := range fields {
+			annotation := ""
+			if m.Options.Provenance {
+				annotation = provenanceComment(m.relPosition(f.pos), "")
+			}
+			field, err := fieldText(m.Fset, f.field, f.field.Names[0].Name, annotation)
+			if err != nil {
+				return err
+			}
+			text.WriteString(field)
+			text.WriteString("\n")
+		}
+		out = append(out[:closing:closing], append(text.Bytes(), out[closing:]...)...)
+	}
+	_, err = w.Write(out[len("package p\n\n"):])
+	return err
+}
+
+// WriteFile writes the formatted merged file.
+func (m *Merger) WriteFile(file string) error {
+	src, err := m.Format()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, src, 0644)
+}
+
+// lineDirective returns a //line directive for the given position
+func lineDirective(pos token.Position) string {
+	return fmt.Sprintf("//line %v:%v", pos.Filename, pos.Line)
+}
+
+// lineNode is a spec or a struct field of a printed declaration
+type lineNode struct {
+	printed ast.Node
+	// src and srcEnd are the positions of the node in its source file
+	src, srcEnd token.Position
+	// names declared by the node
+	names []string
+}
+
+// lineNodes returns the specs and struct fields of the printed declaration
+// together with their positions in the source files. Merged fields have
+// the positions of the file they were merged from.
+func (m *Merger) lineNodes(printed, decl ast.Decl) ([]lineNode, error) {
+	if _, ok := decl.(*ast.GenDecl); !ok {
+		return nil, nil
+	}
+	sources := []lineNode{}
+	source := func(n ast.Node, names ...*ast.Ident) lineNode {
+		node := lineNode{src: m.Fset.Position(n.Pos()), srcEnd: m.Fset.Position(n.End())}
+		for _, name := range names {
+			node.names = append(node.names, name.Name)
+		}
+		return node
+	}
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.TypeSpec:
+			sources = append(sources, source(n, n.Name))
+		case *ast.ValueSpec:
+			sources = append(sources, source(n, n.Names...))
+		case *ast.StructType:
+			merged := m.mergedFields[n]
+			own := len(n.Fields.List) - len(merged)
+			for _, f := range n.Fields.List[:own] {
+				sources = append(sources, source(f, f.Names...))
+			}
+			for _, f := range merged {
+				node := source(f.field, f.field.Names...)
+				node.src = f.pos
+				sources = append(sources, node)
+			}
+		}
+		return true
+	})
+	nodes := []lineNode{}
+	ast.Inspect(printed, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.TypeSpec, *ast.ValueSpec:
+			nodes = append(nodes, lineNode{printed: n})
+		case *ast.StructType:
+			for _, f := range n.Fields.List {
+				nodes = append(nodes, lineNode{printed: f})
+			}
+		}
+		return true
+	})
+	if len(nodes) != len(sources) {
+		return nil, fmt.Errorf("printed declaration has %v specs and fields instead of %v", len(nodes), len(sources))
+	}
+	for i := range nodes {
+		sources[i].printed = nodes[i].printed
+	}
+	return sources, nil
+}
+
+// nodeDirectives adds a line directive before each spec and struct field of
+// the printed declaration, whose source line differs from the line the
+// previous directive maps it to. This happens for merged fields and
+// for specs after removed duplicates. A //line directive must start
+// at the beginning of a line, so the indented directives use the
+// /*line*/ form, which sets the line of the following newline.
+func (m *Merger) nodeDirectives(decl ast.Decl, text []byte) ([]byte, error) {
+	if !decl.Pos().IsValid() {
+		return text, nil
+	}
+	const prefix = "package p\n\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", prefix+string(text), parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	printed := file.Decls[0]
+	nodes, err := m.lineNodes(printed, decl)
+	if err != nil {
+		return nil, err
+	}
+
+	// the directive before the declaration maps its first line
+	pos := m.Fset.Position(decl.Pos())
+	filename, offset := pos.Filename, pos.Line-fset.Position(printed.Pos()).Line
+	out := &bytes.Buffer{}
+	written := len(prefix)
+	src := []byte(prefix + string(text))
+	for _, n := range nodes {
+		start := fset.Position(n.printed.Pos())
+		if n.src.Filename == filename && start.Line+offset == n.src.Line {
+			continue
+		}
+		filename, offset = n.src.Filename, n.src.Line-start.Line
+
+		lineStart := start.Offset - (start.Column - 1)
+		out.Write(src[written:lineStart])
+		written = lineStart
+		directive := m.relPosition(n.src)
+		fmt.Fprintf(out, "/*line %v:%v*/\n", directive.Filename, directive.Line-1)
+	}
+	out.Write(src[written:])
+	return out.Bytes(), nil
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, e := range list {
+		if e == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,189 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// provenanceDirective prefixes the provenance annotations
+const provenanceDirective = "//srcmerge:origin "
+
+// Origin describes where a declaration of the merged file comes from.
+type Origin struct {
+	// Name of the declaration in the merged file
+	Name string `json:"name"`
+	// Original name of the declaration, if it was renamed
+	Original string `json:"original,omitempty"`
+	// Pos of the declaration in the source file
+	Pos token.Position `json:"pos"`
+	// Duplicates are identical declarations of other source files, which were removed
+	Duplicates []token.Position `json:"duplicates,omitempty"`
+	// Fields which were added from other source files, if the declaration is a struct
+	Fields []*Origin `json:"fields,omitempty"`
+
+	// duplicateFields are the field names of each duplicate, if the declaration is a struct
+	duplicateFields [][]string
+}
+
+func (m *Merger) addOrigin(name, original string, pos token.Position) {
+	origin := &Origin{Name: name, Pos: pos}
+	if name != original {
+		origin.Original = original
+	}
+	m.origins[name] = origin
+	m.originNames = append(m.originNames, name)
+}
+
+// addDuplicate adds a removed duplicate of a declaration. The fields of
+// a duplicate struct are kept, because it may have fewer fields than the
+// merged struct.
+func (m *Merger) addDuplicate(name string, pos token.Position, dec ast.Node) {
+	if origin := m.origins[name]; origin != nil {
+		origin.Duplicates = append(origin.Duplicates, pos)
+		var fields []string
+		if structType, ok := dec.(*ast.StructType); ok {
+			fields = FieldNames(structType.Fields)
+		}
+		origin.duplicateFields = append(origin.duplicateFields, fields)
+	}
+}
+
+func (m *Merger) addFieldOrigin(structName, field string, pos token.Position) {
+	if origin := m.origins[structName]; origin != nil {
+		origin.Fields = append(origin.Fields, &Origin{Name: field, Pos: pos})
+	}
+}
+
+func (m *Merger) removeOrigin(name string) {
+	if _, ok := m.origins[name]; !ok {
+		return
+	}
+	delete(m.origins, name)
+	for i, n := range m.originNames {
+		if n == name {
+			m.originNames = append(m.originNames[:i], m.originNames[i+1:]...)
+			break
+		}
+	}
+}
+
+// Origin returns the origin of a declaration of the merged file.
+func (m *Merger) Origin(name string) *Origin {
+	return m.origins[name]
+}
+
+// Origins returns the origins of all declarations in the order they were merged.
+func (m *Merger) Origins() []*Origin {
+	origins := make([]*Origin, len(m.originNames))
+	for i, name := range m.originNames {
+		origins[i] = m.origins[name]
+	}
+	return origins
+}
+
+// relPosition makes the file name of a position relative to the BaseDir.
+func (m *Merger) relPosition(pos token.Position) token.Position {
+	if m.BaseDir == "" {
+		return pos
+	}
+	if rel, err := filepath.Rel(m.BaseDir, pos.Filename); err == nil {
+		pos.Filename = filepath.ToSlash(rel)
+	}
+	return pos
+}
+
+// provenance returns the provenance annotations of a declaration.
+func (m *Merger) provenance(decl ast.Decl) string {
+	lines := []string{}
+	for _, origin := range m.declOrigins(decl) {
+		name := origin.Name
+		line := provenanceComment(m.relPosition(origin.Pos), name)
+		if origin.Original != "" {
+			line += " renamed=" + origin.Original
+		}
+		if len(origin.Duplicates) > 0 {
+			duplicates := make([]string, len(origin.Duplicates))
+			for i, pos := range origin.Duplicates {
+				duplicates[i] = positionString(m.relPosition(pos))
+			}
+			line += " duplicates=" + strings.Join(duplicates, ",")
+			if omits := m.omittedFields(name, origin); len(omits) > 0 {
+				line += " omits=" + strings.Join(omits, ",")
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// declOrigins returns the origins of the names a declaration declares. The
+// origins of init functions and blank names are found by their position.
+func (m *Merger) declOrigins(decl ast.Decl) []*Origin {
+	origins := []*Origin{}
+	add := func(name string, ident *ast.Ident) {
+		origin := m.origins[name]
+		if name == "init" || name == "_" {
+			origin = m.unnamedOrigins[ident.Pos()]
+		}
+		if origin != nil {
+			origins = append(origins, origin)
+		}
+	}
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		add(funcName(decl), decl.Name)
+	case *ast.GenDecl:
+		for _, spec := range decl.Specs {
+			switch spec := spec.(type) {
+			case *ast.TypeSpec:
+				add(spec.Name.Name, spec.Name)
+			case *ast.ValueSpec:
+				for _, name := range spec.Names {
+					add(name.Name, name)
+				}
+			}
+		}
+	}
+	return origins
+}
+
+// omittedFields returns the fields of the merged struct, which a duplicate doesn't
+// have, as "file:line=field+field" for each of these duplicates.
+func (m *Merger) omittedFields(name string, origin *Origin) []string {
+	structType, ok := m.declares[name].(*ast.StructType)
+	if !ok {
+		return nil
+	}
+	omits := []string{}
+	for i, fields := range origin.duplicateFields {
+		has := map[string]bool{}
+		for _, field := range fields {
+			has[field] = true
+		}
+		omitted := []string{}
+		for _, field := range FieldNames(structType.Fields) {
+			if !has[field] {
+				omitted = append(omitted, field)
+			}
+		}
+		if len(omitted) > 0 {
+			omits = append(omits, positionString(m.relPosition(origin.Duplicates[i]))+"="+strings.Join(omitted, "+"))
+		}
+	}
+	return omits
+}
+
+// provenanceComment formats a single provenance annotation
+func provenanceComment(pos token.Position, name string) string {
+	if name == "" {
+		return provenanceDirective + positionString(pos)
+	}
+	return fmt.Sprintf("%v%v %v", provenanceDirective, name, positionString(pos))
+}
+
+func positionString(pos token.Position) string {
+	return fmt.Sprintf("%v:%v", pos.Filename, pos.Line)
+}
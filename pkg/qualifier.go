@@ -0,0 +1,49 @@
+package pkg
+
+import "go/ast"
+
+// resolveQualifier marks all qualifiers of an import with an object of the package,
+// whose data is the import path. Qualifiers are the unresolved identifiers
+// of selector expressions with the name of the import. Local declarations
+// with the same name are resolved by the parser, so they are not marked.
+// Qualifiers, which were already resolved to the import, get the new object.
+func resolveQualifier(node ast.Node, name, iPath string) *ast.Object {
+	obj := ast.NewObj(ast.Pkg, name)
+	obj.Data = iPath
+	ast.Inspect(node, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Name == name && (ident.Obj == nil || isPackageObj(ident.Obj, iPath)) {
+				ident.Obj = obj
+			}
+		}
+		return true
+	})
+	return obj
+}
+
+// isPackageObj checks whether the object is a resolved import of the path
+func isPackageObj(obj *ast.Object, iPath string) bool {
+	return obj.Kind == ast.Pkg && obj.Data == iPath
+}
+
+// renameQualifier renames the qualifiers of the package object. Other
+// identifiers, like locals or fields with the same name, are kept.
+func renameQualifier(node ast.Node, obj *ast.Object, newName string) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Obj == obj {
+			ident.Name = newName
+		}
+		return true
+	})
+	obj.Name = newName
+}
+
+// qualifierPath returns the import path of a resolved qualifier
+func qualifierPath(x ast.Expr) (string, bool) {
+	ident, ok := x.(*ast.Ident)
+	if !ok || ident.Obj == nil || ident.Obj.Kind != ast.Pkg {
+		return "", false
+	}
+	iPath, ok := ident.Obj.Data.(string)
+	return iPath, ok
+}
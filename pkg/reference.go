@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// reference is a qualified identifier, which refers to
+// a declaration of another merged package.
+type reference struct {
+	sel  *ast.SelectorExpr
+	path string
+}
+
+// isPackage checks whether an import path is one of the merged packages
+func (m *Merger) isPackage(iPath string) bool {
+	for _, p := range m.Packages {
+		if p == iPath {
+			return true
+		}
+	}
+	return false
+}
+
+// findReferences finds all qualified identifiers of b which refer
+// to the merged package, that is imported with the given name.
+func (m *Merger) findReferences(b *ast.File, name, iPath string) {
+	ast.Inspect(b, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		// a declared identifier would shadow the import
+		if ident, ok := sel.X.(*ast.Ident); ok && ident.Name == name && ident.Obj == nil {
+			m.references = append(m.references, reference{sel, iPath})
+			return false
+		}
+		return true
+	})
+}
+
+// resolveReferences replaces the qualified identifiers, which refer to
+// already merged packages, with the identifier of the merged declaration.
+// It fails if a local declaration would shadow the merged declaration.
+func (m *Merger) resolveReferences() error {
+	replacements := map[*ast.SelectorExpr]*ast.Ident{}
+	pending := m.references[:0]
+	for _, ref := range m.references {
+		renames, merged := m.renames[ref.path]
+		if !merged {
+			pending = append(pending, ref)
+			continue
+		}
+		name := ref.sel.Sel.Name
+		if newName, ok := renames[name]; ok {
+			name = newName
+		}
+		replacements[ref.sel] = &ast.Ident{NamePos: ref.sel.Pos(), Name: name}
+	}
+	m.references = pending
+	if len(replacements) == 0 {
+		return nil
+	}
+
+	var err error
+	for _, decl := range m.File.Decls {
+		locals, bodies := localNames(decl), funcBodies(decl)
+		astutil.Apply(decl, func(c *astutil.Cursor) bool {
+			sel, ok := c.Node().(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			ident, ok := replacements[sel]
+			if !ok {
+				return true
+			}
+			// the parameters of a func are only in scope of its body
+			if locals[ident.Name] && inBody(bodies, sel) && err == nil {
+				err = fmt.Errorf("%v: reference %v.%v would be shadowed by the local declaration %v",
+					m.Fset.Position(sel.Pos()), sel.X, sel.Sel.Name, ident.Name)
+			}
+			c.Replace(ident)
+			return false
+		}, nil)
+	}
+	return err
+}
+
+// localNames returns the names of the local declarations of the func bodies
+// of a declaration, like parameters and variables. The parser resolves
+// identifiers to their local declaration, package level declarations are
+// declared outside of the declaration. Struct fields and labels never shadow.
+func localNames(decl ast.Decl) map[string]bool {
+	params := map[ast.Node]bool{}
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Recv != nil {
+				for _, f := range n.Recv.List {
+					params[f] = true
+				}
+			}
+		case *ast.FuncType:
+			for _, list := range []*ast.FieldList{n.Params, n.Results} {
+				if list != nil {
+					for _, f := range list.List {
+						params[f] = true
+					}
+				}
+			}
+		}
+		return true
+	})
+
+	locals := map[string]bool{}
+	ast.Inspect(decl, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok || ident.Obj == nil || ident.Obj.Kind == ast.Pkg || ident.Obj.Kind == ast.Lbl {
+			return true
+		}
+		node, ok := ident.Obj.Decl.(ast.Node)
+		if !ok || node.Pos() < decl.Pos() || node.End() > decl.End() {
+			return true
+		}
+		switch node := node.(type) {
+		case *ast.Field:
+			locals[ident.Name] = locals[ident.Name] || params[node]
+		case ast.Spec:
+			if genDecl, ok := decl.(*ast.GenDecl); !ok || !declaresSpec(genDecl, node) {
+				locals[ident.Name] = true
+			}
+		default:
+			locals[ident.Name] = true
+		}
+		return true
+	})
+	return locals
+}
+
+// funcBodies returns the bodies of the funcs of a declaration
+func funcBodies(decl ast.Decl) []*ast.BlockStmt {
+	bodies := []*ast.BlockStmt{}
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil {
+				bodies = append(bodies, n.Body)
+			}
+		case *ast.FuncLit:
+			bodies = append(bodies, n.Body)
+		}
+		return true
+	})
+	return bodies
+}
+
+// inBody checks whether the node is within one of the bodies
+func inBody(bodies []*ast.BlockStmt, node ast.Node) bool {
+	for _, body := range bodies {
+		if node.Pos() >= body.Pos() && node.End() <= body.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// declaresSpec checks whether the node is a spec of the declaration itself
+func declaresSpec(decl *ast.GenDecl, node ast.Node) bool {
+	for _, spec := range decl.Specs {
+		if spec == node {
+			return true
+		}
+	}
+	return false
+}
+
+// unresolvedReferences returns an error, if references to merged
+// packages remain, whose package contributed no declarations.
+func (m *Merger) unresolvedReferences() error {
+	if len(m.references) == 0 {
+		return nil
+	}
+	refs := make([]string, len(m.references))
+	for i, ref := range m.references {
+		refs[i] = fmt.Sprintf("%v: %v.%v of %q", m.Fset.Position(ref.sel.Pos()), ref.sel.X, ref.sel.Sel.Name, ref.path)
+	}
+	return fmt.Errorf("references to merged packages without declarations:\n%v", strings.Join(refs, "\n"))
+}
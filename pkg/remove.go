@@ -22,7 +22,9 @@ func RemoveDeclByName(declarations []ast.Decl, name string) []ast.Decl {
 }
 
 // RemoveGenDeclByName removes a const, var or type by its declaration name.
-// References which use the declared thing are unchanged.
+// References which use the declared thing are unchanged. A constant of a group,
+// which uses iota or implicit values, is renamed to _ instead, because the
+// values of the other constants depend on its position.
 func RemoveGenDeclByName(declarations []ast.Decl, name string) []ast.Decl {
 	newDecls := make([]ast.Decl, 0, len(declarations))
 	for _, d := range declarations {
@@ -31,6 +33,7 @@ func RemoveGenDeclByName(declarations []ast.Decl, name string) []ast.Decl {
 			newDecls = append(newDecls, d)
 			continue
 		}
+		iotas := iotaGroup(genDecl)
 		newSpecs := genDecl.Specs[:0]
 		for i, spec := range genDecl.Specs {
 			// prevent memory leaks if we deleted an item earlier
@@ -42,12 +45,30 @@ func RemoveGenDeclByName(declarations []ast.Decl, name string) []ast.Decl {
 					newSpecs = append(newSpecs, spec)
 				}
 			case *ast.ValueSpec:
+				if (len(spec.Values) > 0 && len(spec.Values) != len(spec.Names)) || iotas {
+					// a multi value expression can't be split and the values of
+					// an iota group depend on the position ... just don't declare
+					// the name anymore
+					blank := true
+					for _, ident := range spec.Names {
+						if ident.Name == name {
+							ident.Name = "_"
+						}
+						blank = blank && ident.Name == "_"
+					}
+					if !blank || iotas {
+						newSpecs = append(newSpecs, spec)
+					}
+					continue
+				}
 				names := spec.Names[:0]
 				values := spec.Values[:0]
 				for i, ident := range spec.Names {
 					if ident.Name != name {
 						names = append(names, ident)
-						values = append(values, spec.Values[i])
+						if len(spec.Values) > 0 {
+							values = append(values, spec.Values[i])
+						}
 					}
 				}
 				if len(names) > 0 {
@@ -59,6 +80,10 @@ func RemoveGenDeclByName(declarations []ast.Decl, name string) []ast.Decl {
 				newSpecs = append(newSpecs, spec)
 			}
 		}
+		if iotas && blankSpecs(newSpecs) {
+			// the constants of the group aren't declared anymore
+			newSpecs = nil
+		}
 		if len(newSpecs) > 0 {
 			// if there are still spec entries, add the remaining
 			genDecl.Specs = newSpecs
@@ -68,6 +93,36 @@ func RemoveGenDeclByName(declarations []ast.Decl, name string) []ast.Decl {
 	return newDecls
 }
 
+// iotaGroup checks whether the position of a constant in its group matters,
+// because the group uses iota or implicit values
+func iotaGroup(genDecl *ast.GenDecl) bool {
+	if genDecl.Tok != token.CONST {
+		return false
+	}
+	for _, spec := range genDecl.Specs {
+		if spec, ok := spec.(*ast.ValueSpec); ok && (len(spec.Values) == 0 || identUsed(spec, "iota")) {
+			return true
+		}
+	}
+	return false
+}
+
+// blankSpecs checks whether the specs only declare _
+func blankSpecs(specs []ast.Spec) bool {
+	for _, spec := range specs {
+		spec, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			return false
+		}
+		for _, ident := range spec.Names {
+			if ident.Name != "_" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func RemoveImports(file *ast.File) {
 	newDecls := file.Decls[:0]
 	for i, decl := range file.Decls {
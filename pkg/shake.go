@@ -0,0 +1,257 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// shakeUnit is a part of the merged file, which is kept or removed as a whole.
+type shakeUnit struct {
+	names []string
+	// kind is func, method, type, var or const
+	kind    string
+	refs    map[string]bool
+	members map[string]bool
+	// recv and method are set if the unit is a method
+	recv, method string
+	root         bool
+	reached      bool
+}
+
+// Shake removes all declarations of the merged file, which aren't reachable
+// from the given roots. Roots are names or patterns like "New*" or "Client.*".
+// Init functions, blank declarations and vars which are initialized by a call
+// are always reachable, because of their side effects. Methods of reachable
+// types are kept, if they are exported or their name is used, e.g. by an interface.
+// Imports which aren't used anymore are removed too.
+func (m *Merger) Shake(roots []string) error {
+	return m.shake(roots, true)
+}
+
+// Extract removes all declarations of the merged file, which the roots
+// don't depend on. Unlike Shake, side effects are not kept.
+func (m *Merger) Extract(roots []string) error {
+	return m.shake(roots, false)
+}
+
+func (m *Merger) shake(roots []string, sideEffects bool) error {
+	units := m.shakeUnits()
+	if !sideEffects {
+		for _, unit := range units {
+			unit.root = false
+		}
+	}
+	for _, root := range roots {
+		matched := false
+		for _, unit := range units {
+			for _, name := range unit.names {
+				if ok, err := path.Match(root, strings.TrimPrefix(name, "*")); err != nil {
+					return fmt.Errorf("invalid root %q: %w", root, err)
+				} else if ok {
+					unit.root = true
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return fmt.Errorf("root %q matches no declaration", root)
+		}
+	}
+
+	reached := map[string]bool{}
+	members := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, unit := range units {
+			if unit.reached || !unit.reachable(reached, members) {
+				continue
+			}
+			unit.reached = true
+			changed = true
+			for _, name := range unit.names {
+				reached[name] = true
+			}
+			for ref := range unit.refs {
+				reached[ref] = true
+			}
+			for member := range unit.members {
+				members[member] = true
+			}
+		}
+	}
+
+	for _, unit := range units {
+		if unit.reached {
+			continue
+		}
+		for _, name := range unit.names {
+			if origin := m.origins[name]; origin != nil {
+				decision := Decision{Name: name, Kind: unit.kind, Pos: origin.Pos, Outcome: OutcomeRemoved, Reason: "not reachable from the roots"}
+				if origin.Original != "" {
+					decision.Name, decision.NewName = origin.Original, name
+				}
+				m.addDecision(decision)
+			}
+			m.removeDecl(&m.File, name)
+			m.removeOrigin(name)
+			delete(m.declares, name)
+		}
+	}
+	m.removeUnusedImports()
+	return nil
+}
+
+func (u *shakeUnit) reachable(reached, members map[string]bool) bool {
+	if u.root {
+		return true
+	}
+	if u.method != "" {
+		return reached[u.recv] && (ast.IsExported(u.method) || members[u.method])
+	}
+	for _, name := range u.names {
+		if reached[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// shakeUnits splits the merged declarations into units. Constants of a group
+// stay together, because they could depend on their order by iota.
+func (m *Merger) shakeUnits() []*shakeUnit {
+	units := []*shakeUnit{}
+	for _, decl := range m.File.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			unit := newShakeUnit("func", decl, funcName(decl))
+			if decl.Recv != nil {
+				unit.kind = "method"
+				unit.recv = typeName(decl.Recv.List[0].Type)
+				unit.method = decl.Name.Name
+			} else {
+				unit.root = decl.Name.Name == "init"
+			}
+			units = append(units, unit)
+		case *ast.GenDecl:
+			switch decl.Tok {
+			case token.CONST:
+				units = append(units, newShakeUnit(decl.Tok.String(), decl, declNames(decl)...))
+			case token.VAR, token.TYPE:
+				for _, spec := range decl.Specs {
+					unit := newShakeUnit(decl.Tok.String(), spec, declNames(&ast.GenDecl{Specs: []ast.Spec{spec}})...)
+					if valueSpec, ok := spec.(*ast.ValueSpec); ok {
+						unit.root = hasSideEffects(valueSpec)
+					}
+					units = append(units, unit)
+				}
+			}
+		}
+	}
+	return units
+}
+
+func newShakeUnit(kind string, node ast.Node, names ...string) *shakeUnit {
+	unit := &shakeUnit{names: names, kind: kind, refs: declRefs(node), members: map[string]bool{}}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			unit.members[n.Sel.Name] = true
+		case *ast.InterfaceType:
+			for _, method := range n.Methods.List {
+				for _, name := range method.Names {
+					unit.members[name.Name] = true
+				}
+			}
+		}
+		return true
+	})
+	for _, name := range names {
+		if name == "_" {
+			unit.root = true
+		}
+	}
+	return unit
+}
+
+// hasSideEffects checks whether a var is initialized by a call
+func hasSideEffects(spec *ast.ValueSpec) bool {
+	call := false
+	for _, value := range spec.Values {
+		ast.Inspect(value, func(n ast.Node) bool {
+			if _, ok := n.(*ast.FuncLit); ok {
+				// a function literal is not called by its declaration
+				return false
+			}
+			if _, ok := n.(*ast.CallExpr); ok {
+				call = true
+			}
+			return !call
+		})
+	}
+	return call
+}
+
+// removeUnusedImports removes all named imports which aren't used by any declaration
+func (m *Merger) removeUnusedImports() {
+	specs := m.importsDecl.Specs[:0]
+	for _, spec := range m.importsDecl.Specs {
+		impSpec := spec.(*ast.ImportSpec)
+		if m.importUsed(impSpec) {
+			specs = append(specs, spec)
+			continue
+		}
+		iPath, _ := strconv.Unquote(impSpec.Path.Value)
+		for i, imp := range m.File.Imports {
+			if imp == impSpec {
+				m.File.Imports = append(m.File.Imports[:i], m.File.Imports[i+1:]...)
+				break
+			}
+		}
+		delete(m.imports, importName(impSpec))
+		delete(m.importNames, iPath)
+	}
+	m.importsDecl.Specs = specs
+
+	if len(specs) == 0 {
+		for i, decl := range m.File.Decls {
+			if decl == &m.importsDecl {
+				m.File.Decls = append(m.File.Decls[:i], m.File.Decls[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (m *Merger) importUsed(impSpec *ast.ImportSpec) bool {
+	return importUsed(m.File.Decls, impSpec)
+}
+
+// importUsed checks whether an import is used by any of the declarations
+func importUsed(decls []ast.Decl, impSpec *ast.ImportSpec) bool {
+	name := importName(impSpec)
+	if name == "_" || name == "." {
+		return true
+	}
+	for _, decl := range decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+			continue
+		}
+		if identUsed(decl, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// importName returns the name an import declares
+func importName(impSpec *ast.ImportSpec) string {
+	if impSpec.Name != nil {
+		return impSpec.Name.Name
+	}
+	iPath, _ := strconv.Unquote(impSpec.Path.Value)
+	return path.Base(iPath)
+}
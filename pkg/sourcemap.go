@@ -0,0 +1,141 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// SourceMap maps line ranges of the merged file to the source files.
+type SourceMap struct {
+	File     string          `json:"file"`
+	Mappings []SourceMapping `json:"mappings"`
+}
+
+// SourceMapping maps the lines of one declaration of the merged file.
+type SourceMapping struct {
+	Output LineRange `json:"output"`
+	Source string    `json:"source"`
+	Input  LineRange `json:"input"`
+	// Names declared by the declaration
+	Names []string `json:"names"`
+	// Renames maps the name in the merged file to the name in the source file
+	Renames map[string]string `json:"renames,omitempty"`
+}
+
+// LineRange is a range of lines, both are inclusive.
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// SourceMap creates the source map of the formatted merged file. Each func,
+// spec and struct field gets its own mapping, because specs and fields of
+// one declaration can come from different source files. The mappings of
+// fields are within the mapping of their spec, the innermost one applies.
+func (m *Merger) SourceMap(formatted []byte, fileName string) (*SourceMap, error) {
+	fset, _, outDecls, err := m.parseFormatted(formatted, fileName)
+	if err != nil {
+		return nil, err
+	}
+	mappings, err := m.nodeMappings(fset, outDecls)
+	if err != nil {
+		return nil, err
+	}
+
+	sm := &SourceMap{File: fileName, Mappings: []SourceMapping{}}
+	for _, nm := range mappings {
+		mapping := SourceMapping{
+			Output: nm.out,
+			Source: m.relPosition(nm.src).Filename,
+			Input:  LineRange{Start: nm.src.Line, End: nm.srcEnd},
+			Names:  nm.names,
+		}
+		for _, name := range mapping.Names {
+			if origin := m.origins[name]; origin != nil && origin.Original != "" && !nm.field {
+				if mapping.Renames == nil {
+					mapping.Renames = map[string]string{}
+				}
+				mapping.Renames[name] = origin.Original
+			}
+		}
+		sm.Mappings = append(sm.Mappings, mapping)
+	}
+	return sm, nil
+}
+
+// nodeMapping maps the lines of a func, spec or struct field of
+// the formatted merged file to its source file.
+type nodeMapping struct {
+	out LineRange
+	// src is the start of the node in the source file, srcEnd its last line
+	src    token.Position
+	srcEnd int
+	names  []string
+	field  bool
+}
+
+// nodeMappings returns the mappings of all merged declarations, their specs
+// and struct fields in the order of the formatted file. The ranges start
+// at the nodes, not at their documentation.
+func (m *Merger) nodeMappings(fset *token.FileSet, outDecls []ast.Decl) ([]nodeMapping, error) {
+	mappings := []nodeMapping{}
+	for i, decl := range m.File.Decls {
+		if !decl.Pos().IsValid() {
+			// no source ... e.g. the imports
+			continue
+		}
+		if _, ok := decl.(*ast.FuncDecl); ok {
+			mappings = append(mappings, nodeMapping{
+				out:    outRange(fset, outDecls[i]),
+				src:    m.Fset.Position(decl.Pos()),
+				srcEnd: m.Fset.Position(decl.End()).Line,
+				names:  declNames(decl),
+			})
+			continue
+		}
+		nodes, err := m.lineNodes(outDecls[i], decl)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			_, field := node.printed.(*ast.Field)
+			mappings = append(mappings, nodeMapping{
+				out:    outRange(fset, node.printed),
+				src:    node.src,
+				srcEnd: node.srcEnd.Line,
+				names:  node.names,
+				field:  field,
+			})
+		}
+	}
+	return mappings, nil
+}
+
+// outRange returns the lines of a node of the formatted merged file
+func outRange(fset *token.FileSet, node ast.Node) LineRange {
+	return LineRange{
+		Start: fset.PositionFor(node.Pos(), false).Line,
+		End:   fset.PositionFor(node.End(), false).Line,
+	}
+}
+
+// parseFormatted parses the formatted merged file. The returned declarations
+// match the declarations of the merged file one by one.
+func (m *Merger) parseFormatted(formatted []byte, fileName string) (*token.FileSet, *ast.File, []ast.Decl, error) {
+	fset := token.NewFileSet()
+	out, err := parser.ParseFile(fset, fileName, formatted, parser.ParseComments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	decls := out.Decls
+	if m.cgo.used {
+		// the import of the cgo pseudo package isn't part of the merged declarations
+		decls = decls[1:]
+	}
+	if len(decls) != len(m.File.Decls) {
+		return nil, nil, nil, fmt.Errorf("formatted file doesn't match the merged declarations")
+	}
+	return fset, out, decls, nil
+}
@@ -0,0 +1,213 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+)
+
+// Source is a source file of MergeSources. The content is read from
+// Reader, if it is set, otherwise Src is the content.
+type Source struct {
+	// Name of the file, it is used for positions and annotations
+	Name   string
+	Src    []byte
+	Reader io.Reader
+
+	// Postfix of conflicting declarations, which get renamed
+	Postfix string
+
+	// SamePackage merges the source together with the previous source as files
+	// of one package. Their declarations are never deduplicated or renamed
+	// against each other. Postfix, ImportPath and Prefix must be the same.
+	SamePackage bool
+
+	// ImportPath of the package, it is needed to resolve references
+	// of other merged packages to this package
+	ImportPath string
+
+	// Prefix bundles the package, all its declarations get the prefix
+	Prefix string
+}
+
+// MergeOptions are the options of MergeSources.
+type MergeOptions struct {
+	Options
+
+	// PackageName of the merged file
+	PackageName string
+
+	// FileName of the merged file, it is used for positions of the merged file
+	FileName string
+
+	// BaseDir and Header, see Merger
+	BaseDir string
+	Header  string
+
+	// Keep are the roots of a Shake, Extract the roots of an Extract
+	Keep    []string
+	Extract []string
+
+	// TypeCheck type checks the merged file, dependencies are imported by the
+	// Importer. If no Importer is set, dependencies are type checked from source.
+	TypeCheck bool
+	Importer  types.Importer
+
+	// Files splits the merged file into the files of a package, see SplitPackage
+	Files    SplitStrategy
+	MaxDecls int
+
+	// Events handles the events of the merge, nil discards them
+	Events EventHandler
+}
+
+// Result of MergeSources.
+type Result struct {
+	// Src is the formatted merged file
+	Src []byte
+
+	// File is the parsed merged file, its positions refer to Fset
+	File *ast.File
+	Fset *token.FileSet
+
+	// Files of the merged package, if MergeOptions.Files is set
+	Files []SplitFile
+
+	// Package is the type checked merged package, if MergeOptions.TypeCheck is set
+	Package *types.Package
+
+	Report Report
+
+	// Merger gives access to the merged declarations, e.g. to create a SourceMap
+	Merger *Merger
+}
+
+// Report describes what a merge did.
+type Report struct {
+	// Decisions about every declaration and import of the source files
+	Decisions []Decision `json:"decisions"`
+	// Origins of all declarations of the merged file
+	Origins []*Origin `json:"origins"`
+	// UnusedImportRewrites didn't match any import
+	UnusedImportRewrites []ImportRewrite `json:"unusedImportRewrites,omitempty"`
+}
+
+// MergeSources merges the sources in memory. The merge stops with the
+// error of the context, if the context is done. The context is checked
+// before each source file, declaration and printed declaration.
+func MergeSources(ctx context.Context, sources []Source, options MergeOptions) (*Result, error) {
+	m := NewMerger(options.PackageName)
+	// the sources are parsed into their own FileSet instead of the one of LoadAstFile
+	m.Fset = token.NewFileSet()
+	m.ctx = ctx
+	m.Options = options.Options
+	m.BaseDir = options.BaseDir
+	m.Header = options.Header
+	m.Events = options.Events
+	if options.Files == SplitOrigin {
+		// the files are split by the origin of the declarations
+		m.Options.Provenance = true
+	}
+
+	for _, source := range sources {
+		if source.ImportPath != "" {
+			m.Packages = appendUnique(m.Packages, source.ImportPath)
+		}
+	}
+	for i := 0; i < len(sources); {
+		if sources[i].SamePackage {
+			return nil, fmt.Errorf("%v has no previous source of the same package", sources[i].Name)
+		}
+		j := i + 1
+		for ; j < len(sources) && sources[j].SamePackage; j++ {
+			if sources[j].Postfix != sources[i].Postfix || sources[j].ImportPath != sources[i].ImportPath || sources[j].Prefix != sources[i].Prefix {
+				return nil, fmt.Errorf("%v has another postfix, import path or prefix than %v of the same package", sources[j].Name, sources[i].Name)
+			}
+		}
+		files := make([]*ast.File, 0, j-i)
+		for _, source := range sources[i:j] {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			file, err := source.parse(m.Fset)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+		source := sources[i]
+		var err error
+		if source.Prefix != "" {
+			err = m.BundlePackage(files, source.ImportPath, source.Prefix, source.Postfix)
+		} else {
+			err = m.MergePackage(files, source.ImportPath, source.Postfix)
+		}
+		if err != nil {
+			return nil, err
+		}
+		i = j
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := m.ImportPolicyErr(); err != nil {
+		return nil, err
+	}
+	unused := m.UnusedImportRewrites()
+	for _, r := range unused {
+		m.emit(Warning{Msg: fmt.Sprintf("import rewrite %q was not used", r)})
+	}
+
+	if len(options.Keep) > 0 {
+		if err := m.Shake(options.Keep); err != nil {
+			return nil, err
+		}
+	}
+	if len(options.Extract) > 0 {
+		if err := m.Extract(options.Extract); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	result := &Result{Merger: m, Fset: token.NewFileSet()}
+	if result.Src, err = m.Format(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if result.File, err = parser.ParseFile(result.Fset, options.FileName, result.Src, parser.ParseComments); err != nil {
+		return nil, err
+	}
+	if options.TypeCheck {
+		imp := options.Importer
+		if imp == nil {
+			imp = importer.ForCompiler(token.NewFileSet(), "source", nil)
+		}
+		if result.Package, err = m.Check(result.Src, options.FileName, imp); err != nil {
+			return nil, err
+		}
+	}
+	if options.Files != "" {
+		if result.Files, err = SplitPackage(result.Src, options.FileName, options.Files, options.MaxDecls, options.Provenance); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Report = Report{Decisions: m.Decisions(), Origins: m.Origins(), UnusedImportRewrites: unused}
+	return result, nil
+}
+
+// parse parses the source file
+func (s Source) parse(fset *token.FileSet) (*ast.File, error) {
+	var src interface{} = s.Src
+	if s.Reader != nil {
+		src = s.Reader
+	}
+	return parser.ParseFile(fset, s.Name, src, parser.ParseComments)
+}
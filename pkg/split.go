@@ -0,0 +1,679 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SplitStrategy defines how a merged file is split into multiple files.
+type SplitStrategy string
+
+const (
+	// SplitOrigin writes one file per source file of the merge. It needs
+	// the provenance annotations and restores the original names.
+	SplitOrigin SplitStrategy = "origin"
+	// SplitType writes one file per type with its constructors and methods
+	SplitType SplitStrategy = "type"
+	// SplitMax writes files with a maximum number of declarations
+	SplitMax SplitStrategy = "max"
+)
+
+// ParseSplitStrategy parses the name of a split strategy. An empty name is the origin strategy.
+func ParseSplitStrategy(strategy string) (SplitStrategy, error) {
+	switch s := SplitStrategy(strategy); s {
+	case "":
+		return SplitOrigin, nil
+	case SplitOrigin, SplitType, SplitMax:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown split strategy %q", strategy)
+}
+
+// SplitFile is a file of a split merged file.
+type SplitFile struct {
+	Name string
+	Src  []byte
+}
+
+// generatedComment matches the standard marker of generated files
+var generatedComment = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// splitKeys are the files a spec, or a function, is written to
+type splitKeys struct {
+	// origin is the source file, if the origin strategy is used
+	origin string
+	keys   map[string]bool
+	// fields are the source files of merged struct fields by their index
+	fields []string
+	// omits are the struct fields, which a duplicate source file doesn't have
+	omits map[string]map[string]bool
+}
+
+// CommonFile is the file of SplitPackage with the declarations, which are shared by multiple source files
+const CommonFile = "common.go"
+
+// Split splits a merged file. With the origin strategy the files are named like the source
+// files relative to the merged file, otherwise like the merged file. Duplicates which were
+// removed by the merge are written to each of their source files. The generated header of
+// the merged file is removed and an optional package name replaces the original one.
+func Split(src []byte, fileName string, strategy SplitStrategy, max int, packageName string) ([]SplitFile, error) {
+	return split(src, fileName, strategy, max, splitMode{packageName: packageName})
+}
+
+// SplitPackage splits a merged file into files of the same package. Unlike Split the
+// merged names and struct fields are kept. With the origin strategy the files are named
+// like the base names of the source files and declarations, which were found in multiple
+// source files, are written to the CommonFile. The generated header is kept and the
+// provenance annotations are only kept if annotations is set.
+func SplitPackage(src []byte, fileName string, strategy SplitStrategy, max int, annotations bool) ([]SplitFile, error) {
+	return split(src, fileName, strategy, max, splitMode{pkg: true, annotations: annotations})
+}
+
+// splitMode are the options of a split
+type splitMode struct {
+	// pkg keeps the merged package as it is, see SplitPackage
+	pkg         bool
+	annotations bool
+	packageName string
+}
+
+func split(src []byte, fileName string, strategy SplitStrategy, max int, mode splitMode) ([]SplitFile, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(path.Base(fileName), ".go")
+	if mode.pkg {
+		base = file.Name.Name
+	}
+	var keys [][]splitKeys
+	var names []string
+	renames := map[string]map[string]string{}
+	switch strategy {
+	case SplitOrigin:
+		keys, names, err = splitByOrigin(file, renames)
+		if err == nil && mode.pkg {
+			keys, names = commonKeys(keys, names)
+			renames = nil
+		}
+	case SplitType:
+		keys, names = splitByType(file, base)
+	case SplitMax:
+		if max <= 0 {
+			return nil, fmt.Errorf("the maximum number of declarations must be positive")
+		}
+		keys, names = splitByCount(file, base, max)
+	default:
+		return nil, fmt.Errorf("unknown split strategy %q", strategy)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if mode.pkg {
+		src = stripAnnotations(fset, file, src, false, !mode.annotations, false)
+	} else {
+		src = stripAnnotations(fset, file, src, true, strategy == SplitOrigin, strategy == SplitOrigin)
+	}
+	files := make([]SplitFile, len(names))
+	for i, name := range names {
+		// the package documentation is only needed once in a package
+		docs := !mode.pkg || i == 0
+		out, err := splitFile(src, fileName, name, keys, renames[name], mode.packageName, docs)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = SplitFile{Name: name, Src: out}
+	}
+	return files, nil
+}
+
+// commonKeys assigns the declarations of multiple source files to the CommonFile and all others
+// to the base name of their source file. The common file is the first file, if there is one.
+func commonKeys(keys [][]splitKeys, origins []string) ([][]splitKeys, []string) {
+	baseNames := map[string]string{}
+	used := map[string]bool{CommonFile: true}
+	for _, origin := range origins {
+		name := path.Base(origin)
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%v_%v.go", strings.TrimSuffix(path.Base(origin), ".go"), i)
+		}
+		used[name] = true
+		baseNames[origin] = name
+	}
+
+	names := []string{}
+	common := false
+	for i := range keys {
+		for j, k := range keys[i] {
+			name := CommonFile
+			if len(k.keys) == 1 {
+				name = baseNames[k.origin]
+			} else {
+				common = true
+			}
+			names = appendUnique(names, name)
+			keys[i][j] = splitKeys{keys: map[string]bool{name: true}}
+		}
+	}
+	if common {
+		sorted := []string{CommonFile}
+		for _, name := range names {
+			if name != CommonFile {
+				sorted = append(sorted, name)
+			}
+		}
+		names = sorted
+	}
+	return keys, names
+}
+
+// provenanceEntry is a parsed provenance annotation
+type provenanceEntry struct {
+	name, file, renamed string
+	duplicates          []string
+	omits               map[string]map[string]bool
+}
+
+// parseProvenance parses the provenance annotations of a comment by their names.
+// Names like init and _ can be annotated multiple times.
+func parseProvenance(doc *ast.CommentGroup) map[string][]provenanceEntry {
+	entries := map[string][]provenanceEntry{}
+	if doc == nil {
+		return entries
+	}
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, provenanceDirective) {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(c.Text, provenanceDirective))
+		entry := provenanceEntry{}
+		if len(fields) == 1 {
+			// a merged struct field
+			entry.file = positionFile(fields[0])
+		} else if len(fields) > 1 {
+			entry.name, entry.file = fields[0], positionFile(fields[1])
+			for _, field := range fields[2:] {
+				if renamed := strings.TrimPrefix(field, "renamed="); renamed != field {
+					entry.renamed = renamed
+				} else if duplicates := strings.TrimPrefix(field, "duplicates="); duplicates != field {
+					for _, dup := range strings.Split(duplicates, ",") {
+						entry.duplicates = append(entry.duplicates, positionFile(dup))
+					}
+				} else if omits := strings.TrimPrefix(field, "omits="); omits != field {
+					entry.omits = map[string]map[string]bool{}
+					for _, omit := range strings.Split(omits, ",") {
+						i := strings.LastIndex(omit, "=")
+						if i < 0 {
+							continue
+						}
+						fields := map[string]bool{}
+						for _, f := range strings.Split(omit[i+1:], "+") {
+							fields[f] = true
+						}
+						entry.omits[positionFile(omit[:i])] = fields
+					}
+				}
+			}
+		}
+		entries[entry.name] = append(entries[entry.name], entry)
+	}
+	return entries
+}
+
+// nextProvenance removes the first annotation of a name from the entries
+func nextProvenance(entries map[string][]provenanceEntry, name string) (provenanceEntry, bool) {
+	if len(entries[name]) == 0 {
+		return provenanceEntry{}, false
+	}
+	entry := entries[name][0]
+	entries[name] = entries[name][1:]
+	return entry, true
+}
+
+// positionFile returns the file of a "file:line" position
+func positionFile(pos string) string {
+	if i := strings.LastIndex(pos, ":"); i >= 0 {
+		pos = pos[:i]
+	}
+	// the files are written relative to the split files
+	pos = strings.TrimLeft(path.Clean(filepath.ToSlash(pos)), "/")
+	for strings.HasPrefix(pos, "../") {
+		pos = strings.TrimPrefix(pos, "../")
+	}
+	return pos
+}
+
+// splitByOrigin assigns the declarations to their source files by the provenance annotations
+func splitByOrigin(file *ast.File, renames map[string]map[string]string) ([][]splitKeys, []string, error) {
+	keys := make([][]splitKeys, len(file.Decls))
+	names := []string{}
+	assign := func(entry provenanceEntry) splitKeys {
+		k := splitKeys{origin: entry.file, keys: map[string]bool{}, omits: entry.omits}
+		for _, f := range append([]string{entry.file}, entry.duplicates...) {
+			if !k.keys[f] {
+				k.keys[f] = true
+				names = appendUnique(names, f)
+			}
+		}
+		if entry.renamed != "" {
+			if renames[entry.file] == nil {
+				renames[entry.file] = map[string]string{}
+			}
+			renames[entry.file][entry.name] = entry.renamed
+		}
+		return k
+	}
+
+	for i, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			entry, ok := nextProvenance(parseProvenance(decl.Doc), funcName(decl))
+			if !ok {
+				return nil, nil, fmt.Errorf("%v has no provenance annotation", funcName(decl))
+			}
+			keys[i] = []splitKeys{assign(entry)}
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				continue
+			}
+			entries := parseProvenance(decl.Doc)
+			var group *splitKeys
+			for _, spec := range decl.Specs {
+				name := declNames(&ast.GenDecl{Specs: []ast.Spec{spec}})[0]
+				entry, ok := nextProvenance(entries, name)
+				if !ok {
+					// a blank constant, which replaces a removed duplicate
+					// of an iota group, goes with the rest of its group
+					keys[i] = append(keys[i], splitKeys{})
+					continue
+				}
+				k := assign(entry)
+				if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+					if structType, ok := typeSpec.Type.(*ast.StructType); ok {
+						for _, field := range structType.Fields.List {
+							fieldEntry, _ := nextProvenance(parseProvenance(field.Doc), "")
+							k.fields = append(k.fields, fieldEntry.file)
+						}
+					}
+				}
+				keys[i] = append(keys[i], k)
+				if group == nil {
+					group = &k
+				}
+			}
+			for j, k := range keys[i] {
+				if k.keys != nil {
+					continue
+				}
+				if group == nil {
+					return nil, nil, fmt.Errorf("%v has no provenance annotation", declNames(&ast.GenDecl{Specs: decl.Specs[j : j+1]})[0])
+				}
+				keys[i][j] = splitKeys{origin: group.origin, keys: group.keys}
+			}
+		}
+	}
+	return keys, names, nil
+}
+
+// splitByType assigns each type with its constructors and methods to its own file.
+// All other declarations are assigned to the file with the base name. The file names
+// of types, which only differ in case or are named like the base, get a number.
+func splitByType(file *ast.File, base string) ([][]splitKeys, []string) {
+	isType := map[string]bool{}
+	typeFiles := map[string]string{}
+	used := map[string]bool{base + ".go": true}
+	for _, decl := range file.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+			for _, spec := range genDecl.Specs {
+				typeName := spec.(*ast.TypeSpec).Name.Name
+				isType[typeName] = true
+				name := strings.ToLower(typeName) + ".go"
+				for i := 2; used[name]; i++ {
+					name = fmt.Sprintf("%v_%v.go", strings.ToLower(typeName), i)
+				}
+				used[name] = true
+				typeFiles[typeName] = name
+			}
+		}
+	}
+
+	keys := make([][]splitKeys, len(file.Decls))
+	names := []string{}
+	assign := func(owner string) splitKeys {
+		name := base + ".go"
+		if owner != "" {
+			name = typeFiles[owner]
+		}
+		names = appendUnique(names, name)
+		return splitKeys{keys: map[string]bool{name: true}}
+	}
+	for i, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			keys[i] = []splitKeys{assign(declOwner(decl, isType))}
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				owner := ""
+				if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+					owner = typeSpec.Name.Name
+				}
+				keys[i] = append(keys[i], assign(owner))
+			}
+		}
+	}
+	return keys, names
+}
+
+// splitByCount assigns the declarations in order to files with at most max declarations
+func splitByCount(file *ast.File, base string, max int) ([][]splitKeys, []string) {
+	keys := make([][]splitKeys, len(file.Decls))
+	names := []string{}
+	count := 0
+	for i, decl := range file.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+			continue
+		}
+		name := fmt.Sprintf("%v_%v.go", base, count/max+1)
+		names = appendUnique(names, name)
+		count++
+
+		specs := 1
+		if genDecl, ok := decl.(*ast.GenDecl); ok {
+			specs = len(genDecl.Specs)
+		}
+		for j := 0; j < specs; j++ {
+			keys[i] = append(keys[i], splitKeys{keys: map[string]bool{name: true}})
+		}
+	}
+	return keys, names
+}
+
+// nodeRange is the range of a removed node, including its comments
+type nodeRange struct {
+	pos, end token.Pos
+}
+
+// splitFile creates the file with the given name. The merged file is parsed
+// again, so that the declarations can be changed for each file.
+func splitFile(src []byte, fileName, name string, keys [][]splitKeys, renames map[string]string, packageName string, docs bool) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	// the objects are resolved with all declarations of the merged file,
+	// because the declarations of other files may be used
+	var idents map[string][]*ast.Ident
+	if len(renames) > 0 {
+		idents = packageIdents(fset, file)
+	}
+
+	removed := []nodeRange{}
+	decls := []ast.Decl{}
+	for i, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if keys[i][0].keys[name] {
+				decls = append(decls, decl)
+			} else {
+				removed = append(removed, nodeRange{floatingPos(fset, file, i), decl.End()})
+			}
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				decls = append(decls, decl)
+				continue
+			}
+			specs := []ast.Spec{}
+			for j, spec := range decl.Specs {
+				if !keys[i][j].keys[name] {
+					removed = append(removed, nodeRange{specPos(spec), specEnd(spec)})
+					continue
+				}
+				if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+					removed = append(removed, removeForeignFields(typeSpec, keys[i][j], name)...)
+				}
+				specs = append(specs, spec)
+			}
+			if len(specs) == 0 {
+				removed = append(removed, nodeRange{floatingPos(fset, file, i), decl.End()})
+				continue
+			}
+			decl.Specs = specs
+			decls = append(decls, decl)
+		}
+	}
+	file.Decls = decls
+	moveLparen(fset, decls)
+	removed = append(removed, removeUnusedFileImports(file)...)
+	if !docs && file.Doc != nil {
+		removed = append(removed, nodeRange{file.Doc.Pos(), file.Doc.End()})
+		file.Doc = nil
+	}
+
+	comments := []*ast.CommentGroup{}
+	for _, group := range file.Comments {
+		if !isRemoved(group, removed) {
+			comments = append(comments, group)
+		}
+	}
+	file.Comments = comments
+
+	for merged, original := range renames {
+		for _, ident := range idents[merged] {
+			ident.Name = original
+		}
+		renameDocs(file, merged, original)
+		renameLinknames(file, merged, original)
+	}
+	if packageName != "" {
+		file.Name.Name = packageName
+	}
+
+	out := &bytes.Buffer{}
+	if err := format.Node(out, fset, file); err != nil {
+		return nil, err
+	}
+	return format.Source(out.Bytes())
+}
+
+// floatingPos returns the start of the i-th declaration of a file including the floating
+// comments before it, which are removed together with the declaration. It is the
+// line after the previous declaration, so that its line comment isn't included.
+func floatingPos(fset *token.FileSet, file *ast.File, i int) token.Pos {
+	prev := file.Name.End()
+	if i > 0 {
+		prev = file.Decls[i-1].End()
+	}
+	tokFile := fset.File(prev)
+	if line := tokFile.Line(prev) + 1; line <= tokFile.LineCount() {
+		return tokFile.LineStart(line)
+	}
+	return declPos(file.Decls[i])
+}
+
+// removeForeignFields removes the struct fields, which the source file doesn't have. The source
+// file of the struct doesn't have the fields added by the merge from other source files and
+// a source file of a duplicate doesn't have the fields it omits.
+func removeForeignFields(typeSpec *ast.TypeSpec, k splitKeys, name string) []nodeRange {
+	structType, ok := typeSpec.Type.(*ast.StructType)
+	if !ok || (k.origin != name && k.omits[name] == nil) {
+		return nil
+	}
+	removed := []nodeRange{}
+	fields := structType.Fields.List[:0]
+	for i, field := range structType.Fields.List {
+		if k.origin == name && i < len(k.fields) && k.fields[i] != "" && k.fields[i] != name {
+			removed = append(removed, nodeRange{fieldPos(field), fieldEnd(field)})
+			continue
+		}
+		if omitted := k.omits[name]; omitted != nil {
+			names := field.Names[:0]
+			for _, n := range field.Names {
+				if !omitted[n.Name] {
+					names = append(names, n)
+				}
+			}
+			if len(field.Names) > 0 && len(names) == 0 {
+				removed = append(removed, nodeRange{fieldPos(field), fieldEnd(field)})
+				continue
+			}
+			field.Names = names
+		}
+		fields = append(fields, field)
+	}
+	structType.Fields.List = fields
+	if len(removed) > 0 && len(fields) > 0 {
+		// the struct would end with empty lines otherwise
+		structType.Fields.Closing = fieldEnd(fields[len(fields)-1])
+	}
+	return removed
+}
+
+// removeUnusedFileImports removes the imports, which aren't used by any declaration of the file
+func removeUnusedFileImports(file *ast.File) []nodeRange {
+	removed := []nodeRange{}
+	decls := file.Decls[:0]
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			decls = append(decls, decl)
+			continue
+		}
+		declRange := nodeRange{declPos(genDecl), genDecl.End()}
+		specs := genDecl.Specs[:0]
+		for _, spec := range genDecl.Specs {
+			if importUsed(file.Decls, spec.(*ast.ImportSpec)) {
+				specs = append(specs, spec)
+			} else {
+				removed = append(removed, nodeRange{specPos(spec), specEnd(spec)})
+			}
+		}
+		genDecl.Specs = specs
+		if len(specs) > 0 {
+			decls = append(decls, decl)
+		} else {
+			removed = append(removed, declRange)
+		}
+	}
+	file.Decls = decls
+
+	imports := file.Imports[:0]
+	for _, impSpec := range file.Imports {
+		for _, r := range removed {
+			if impSpec.Pos() >= r.pos && impSpec.Pos() < r.end {
+				impSpec = nil
+				break
+			}
+		}
+		if impSpec != nil {
+			imports = append(imports, impSpec)
+		}
+	}
+	file.Imports = imports
+	return removed
+}
+
+// stripAnnotations removes the generated header, the provenance annotations and the line
+// directives of a merged file, if they are set. Only the comments of the parsed file are
+// removed, not text in strings which looks like them. The lines of the comments are
+// removed from the source, so that no empty lines remain.
+func stripAnnotations(fset *token.FileSet, file *ast.File, src []byte, header, provenance, lineDirectives bool) []byte {
+	strip := func(text string) bool {
+		return (header && (strings.HasPrefix(text, "//srcmerge:manifest ") || generatedComment.MatchString(text))) ||
+			(provenance && strings.HasPrefix(text, provenanceDirective)) ||
+			(lineDirectives && (strings.HasPrefix(text, "//line ") || strings.HasPrefix(text, "/*line ")))
+	}
+	tokFile := fset.File(file.Pos())
+	// lineRange returns the range of a comment including its line,
+	// if nothing else is on it
+	lineRange := func(c *ast.Comment) (int, int) {
+		start, end := tokFile.Offset(c.Pos()), tokFile.Offset(c.End())
+		lineStart := tokFile.Offset(tokFile.LineStart(tokFile.Line(c.Pos())))
+		lineEnd := len(src)
+		if i := bytes.IndexByte(src[end:], '\n'); i >= 0 {
+			lineEnd = end + i + 1
+		}
+		if len(bytes.TrimSpace(src[lineStart:start])) == 0 && len(bytes.TrimSpace(src[end:lineEnd])) == 0 {
+			start, end = lineStart, lineEnd
+		}
+		return start, end
+	}
+
+	out := &bytes.Buffer{}
+	written := 0
+	remove := func(c *ast.Comment) {
+		start, end := lineRange(c)
+		out.Write(src[written:start])
+		written = end
+	}
+	for _, group := range file.Comments {
+		for i, c := range group.List {
+			if !strip(c.Text) {
+				continue
+			}
+			// gofmt separates directives from the documentation by an empty comment line
+			if i > 0 && group.List[i-1].Text == "//" && tokFile.Offset(group.List[i-1].Pos()) >= written {
+				remove(group.List[i-1])
+			}
+			remove(c)
+		}
+	}
+	out.Write(src[written:])
+	return out.Bytes()
+}
+
+func isRemoved(group *ast.CommentGroup, removed []nodeRange) bool {
+	for _, r := range removed {
+		if group.Pos() >= r.pos && group.Pos() <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// specEnd returns the end of a spec, including its line comment
+func specEnd(spec ast.Spec) token.Pos {
+	var comment *ast.CommentGroup
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		comment = spec.Comment
+	case *ast.ValueSpec:
+		comment = spec.Comment
+	case *ast.ImportSpec:
+		comment = spec.Comment
+	}
+	if comment != nil {
+		return comment.End()
+	}
+	return spec.End()
+}
+
+// fieldPos returns the start of a field, including its documentation
+func fieldPos(field *ast.Field) token.Pos {
+	if field.Doc != nil {
+		return field.Doc.Pos()
+	}
+	return field.Pos()
+}
+
+// fieldEnd returns the end of a field, including its line comment
+func fieldEnd(field *ast.Field) token.Pos {
+	if field.Comment != nil {
+		return field.Comment.End()
+	}
+	return field.End()
+}
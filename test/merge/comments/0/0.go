@@ -0,0 +1,34 @@
+// Copyright 2022 The Authors. All rights reserved.
+
+// Package comments tests that comments survive a merge.
+package comments
+
+import "strings"
+
+// the types of the greeter ...
+
+// Options configures the greeter.
+type Options struct {
+	// Name is the name to greet
+	Name string // never empty
+}
+
+// Greet greets someone.
+func Greet(o Options) string {
+	// build the greeting
+	return "Hello " + o.Name /* inline */
+}
+
+var (
+	// Shared is in both files
+	Shared = 1
+	// Upper is only in this file
+	Upper = strings.ToUpper
+)
+
+// NOTE: a free floating comment, which belongs to no declaration
+
+// Mode is the greeting mode.
+type Mode int
+
+// the end of the file
@@ -0,0 +1,25 @@
+// Copyright 2022 The Authors. All rights reserved.
+
+// Package comments is documented twice.
+package comments
+
+// Options configures the greeter.
+type Options struct {
+	// Name is the name to greet
+	Name string // never empty
+
+	// Loud greets in upper case
+	Loud bool `json:"loud"` // defaults to false
+}
+
+// the variables
+
+var (
+	// Shared is in both files
+	Shared = 1
+	// Lower is only in this file
+	Lower = 2
+)
+
+// Mode is a different mode.
+type Mode string
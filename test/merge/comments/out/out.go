@@ -0,0 +1,48 @@
+// Copyright 2022 The Authors. All rights reserved.
+
+// Package comments tests that comments survive a merge.
+//
+// Package comments is documented twice.
+package out
+
+import "strings"
+
+// the types of the greeter ...
+
+// Options configures the greeter.
+type Options struct {
+	// Name is the name to greet
+	Name string // never empty
+	// Loud greets in upper case
+	Loud bool `json:"loud"` // defaults to false
+}
+
+// Greet greets someone.
+func Greet(o Options) string {
+	// build the greeting
+	return "Hello " + o.Name /* inline */
+}
+
+var (
+	// Shared is in both files
+	Shared = 1
+	// Upper is only in this file
+	Upper = strings.ToUpper
+)
+
+// NOTE: a free floating comment, which belongs to no declaration
+
+// Mode is the greeting mode.
+type Mode int
+
+// the end of the file
+
+// the variables
+
+var (
+	// Lower is only in this file
+	Lower = 2
+)
+
+// Mode1 is a different mode.
+type Mode1 string
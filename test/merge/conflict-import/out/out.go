@@ -8,6 +8,7 @@ import (
 func F1() {
 	fmt.Print(1)
 }
+
 func F2() {
 	fmt2.ReadDir("x")
 }
@@ -24,7 +24,11 @@ type Struct1 struct {
 
 func Hello1(s Struct1) {
 	type NewType Struct1
-	var data struct{ NewType }
+
+	var data struct {
+		NewType
+	}
+
 	*s.Struct = Struct1(*data.NewType.Struct)
 	fmt.Print(s.LastName)
 }
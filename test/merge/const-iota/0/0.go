@@ -0,0 +1,7 @@
+package iota
+
+const (
+	A = iota
+	B
+	C
+)
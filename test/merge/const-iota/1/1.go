@@ -0,0 +1,14 @@
+package iota
+
+// A is the same, Q and Z keep their values
+const (
+	A = iota
+	Q
+	Z
+)
+
+// C has the same expression, but another value
+const (
+	P = iota
+	C
+)
@@ -0,0 +1,20 @@
+package out
+
+const (
+	A = iota
+	B
+	C
+)
+
+// A is the same, Q and Z keep their values
+const (
+	_ = iota
+	Q
+	Z
+)
+
+// C has the same expression, but another value
+const (
+	P = iota
+	C1
+)
@@ -0,0 +1,5 @@
+//go:build linux || darwin
+
+package constraints
+
+const Unix = true
@@ -0,0 +1,3 @@
+package constraints
+
+const Wide = 8
@@ -0,0 +1,6 @@
+// +build !windows
+// +build !plan9
+
+package constraints
+
+const Posix = true
@@ -0,0 +1,9 @@
+//go:build (linux || darwin) && amd64 && !windows && !plan9
+
+package out
+
+const Unix = true
+
+const Wide = 8
+
+const Posix = true
@@ -0,0 +1,36 @@
+package deterministic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Config struct {
+	Name string
+	Size int
+}
+
+var (
+	ErrEmpty = errors.New("empty")
+	Sep      = ","
+	Names    = []string{"a", "b"}
+)
+
+func Join(s []string) string {
+	sort.Strings(s)
+	return strings.Join(s, Sep)
+}
+
+func Write(w io.Writer, c Config) {
+	fmt.Fprint(w, c.Name, strconv.Itoa(c.Size))
+}
+
+func Buffer() *bytes.Buffer {
+	return bytes.NewBufferString(os.Args[0])
+}
@@ -0,0 +1,40 @@
+package deterministic
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+type Config struct {
+	Name    string
+	Verbose bool
+	Limit   int
+	Prefix  string
+}
+
+var (
+	ErrEmpty = errors.New("is empty")
+	Sep      = ";"
+	Names    = []string{"a", "b"}
+)
+
+func Join(s []string) string {
+	return strings.Join(s, Sep)
+}
+
+func Write(w io.Writer, c Config) {
+	fmt.Fprint(w, c.Name, c.Prefix)
+}
+
+func Reader() *bufio.Reader {
+	return bufio.NewReader(os.Stdin)
+}
+
+func IsSpace(r rune) bool {
+	return unicode.IsSpace(r)
+}
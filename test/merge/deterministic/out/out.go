@@ -0,0 +1,62 @@
+package out
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type Config struct {
+	Name    string
+	Size    int
+	Verbose bool
+	Limit   int
+	Prefix  string
+}
+
+var (
+	ErrEmpty = errors.New("empty")
+	Sep      = ","
+	Names    = []string{"a", "b"}
+)
+
+func Join(s []string) string {
+	sort.Strings(s)
+	return strings.Join(s, Sep)
+}
+
+func Write(w io.Writer, c Config) {
+	fmt.Fprint(w, c.Name, strconv.Itoa(c.Size))
+}
+
+func Buffer() *bytes.Buffer {
+	return bytes.NewBufferString(os.Args[0])
+}
+
+var (
+	ErrEmpty1 = errors.New("is empty")
+	Sep1      = ";"
+)
+
+func Join1(s []string) string {
+	return strings.Join(s, Sep1)
+}
+
+func Write1(w io.Writer, c Config) {
+	fmt.Fprint(w, c.Name, c.Prefix)
+}
+
+func Reader() *bufio.Reader {
+	return bufio.NewReader(os.Stdin)
+}
+
+func IsSpace(r rune) bool {
+	return unicode.IsSpace(r)
+}
@@ -0,0 +1,19 @@
+package directives
+
+import (
+	_ "embed"
+)
+
+//go:generate go run gen.go
+
+//go:embed out/data.txt
+var Data string
+
+func nanotime() int64 {
+	return 0
+}
+
+//go:noinline
+func Add(a, b int) int {
+	return a + b
+}
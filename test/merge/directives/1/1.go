@@ -0,0 +1,17 @@
+package directives
+
+import (
+	_ "embed"
+	_ "unsafe"
+)
+
+//go:generate go run gen.go
+//go:generate stringer -type Mode
+
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+// Now returns the monotonic time.
+func Now() int64 {
+	return nanotime()
+}
@@ -0,0 +1,29 @@
+package out
+
+//go:generate go run gen.go
+//go:generate stringer -type Mode
+
+import (
+	_ "embed"
+	_ "unsafe"
+)
+
+//go:embed data.txt
+var Data string
+
+func nanotime() int64 {
+	return 0
+}
+
+//go:noinline
+func Add(a, b int) int {
+	return a + b
+}
+
+//go:linkname nanotime1 runtime.nanotime
+func nanotime1() int64
+
+// Now returns the monotonic time.
+func Now() int64 {
+	return nanotime1()
+}
@@ -3,4 +3,5 @@ package out
 var Hello = "World"
 
 type Foo []string
+
 type FooB []int
@@ -0,0 +1,5 @@
+package header
+
+var Hello = "World"
+
+type Foo []string
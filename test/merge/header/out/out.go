@@ -0,0 +1,13 @@
+// Code generated by srcmerge. DO NOT EDIT.
+//srcmerge:manifest {"files":["../a/a.go","../b/b.go"],"postfixes":["A","B"],"package":"out","options":{"importPolicy":{},"provenance":true,"header":true}}
+
+package out
+
+//srcmerge:origin Hello ../a/a.go:3 duplicates=../b/b.go:3
+var Hello = "World"
+
+//srcmerge:origin Foo ../a/a.go:5
+type Foo []string
+
+//srcmerge:origin FooB ../b/b.go:5 renamed=Foo
+type FooB []int
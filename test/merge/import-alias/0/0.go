@@ -0,0 +1,14 @@
+package alias
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+func Hello() {
+	fmt.Println("Hello")
+}
+
+func Random(b []byte) {
+	rand.Read(b)
+}
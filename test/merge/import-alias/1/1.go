@@ -0,0 +1,19 @@
+package alias
+
+import (
+	"crypto/rand"
+	f "fmt"
+)
+
+func Hello() {
+	f.Println("Hello")
+}
+
+func Random(b []byte) {
+	rand.Read(b)
+}
+
+// Count has a parameter named like the alias of fmt
+func Count(f []byte) int {
+	return len(f)
+}
@@ -0,0 +1,8 @@
+package alias
+
+import f "fmt"
+
+// Print has a parameter named like the package fmt
+func Print(fmt string) {
+	f.Println(fmt)
+}
@@ -0,0 +1,30 @@
+package out
+
+import (
+	rand1 "crypto/rand"
+	"fmt"
+	f "fmt"
+	"math/rand"
+)
+
+func Hello() {
+	fmt.Println("Hello")
+}
+
+func Random(b []byte) {
+	rand.Read(b)
+}
+
+func Random1(b []byte) {
+	rand1.Read(b)
+}
+
+// Count has a parameter named like the alias of fmt
+func Count(f []byte) int {
+	return len(f)
+}
+
+// Print has a parameter named like the package fmt
+func Print(fmt string) {
+	f.Println(fmt)
+}
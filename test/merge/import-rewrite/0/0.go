@@ -0,0 +1,7 @@
+package rewrite
+
+import "crypto/rand"
+
+func Random(b []byte) {
+	rand.Read(b)
+}
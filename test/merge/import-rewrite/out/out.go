@@ -0,0 +1,7 @@
+package out
+
+import "crypto/rand"
+
+func Random(b []byte) {
+	rand.Read(b)
+}
@@ -0,0 +1,7 @@
+package unused
+
+import "fmt"
+
+func Hello() {
+	fmt.Println("Hello")
+}
@@ -0,0 +1,13 @@
+package unused
+
+import f "fmt"
+
+// Hello is the only user of the alias f
+func Hello() {
+	f.Println("Hello")
+}
+
+// Twice has a parameter named like the package fmt
+func Twice(fmt int) int {
+	return 2 * fmt
+}
@@ -0,0 +1,12 @@
+package out
+
+import "fmt"
+
+func Hello() {
+	fmt.Println("Hello")
+}
+
+// Twice has a parameter named like the package fmt
+func Twice(fmt int) int {
+	return 2 * fmt
+}
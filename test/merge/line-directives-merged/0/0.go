@@ -0,0 +1,11 @@
+package line
+
+// Options of a run
+type Options struct {
+	Name string
+}
+
+const (
+	A = 1
+	B = 2
+)
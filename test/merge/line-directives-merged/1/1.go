@@ -0,0 +1,18 @@
+package line
+
+// Options of a run
+type Options struct {
+	Name string
+
+	// Retries after a failure
+	Retries int
+	Debug   bool
+}
+
+const (
+	C = 3
+	A = 1
+	B = 2
+	// D is the last constant
+	D = 4
+)
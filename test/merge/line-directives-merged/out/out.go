@@ -0,0 +1,27 @@
+package out
+
+// Options of a run
+//
+//line ../0/0.go:4
+type Options struct {
+	Name string
+	// Retries after a failure
+	/*line ../1/1.go:7*/
+	Retries int
+	Debug   bool
+}
+
+//line ../0/0.go:8
+const (
+	A = 1
+	B = 2
+)
+
+//line ../1/1.go:12
+const (
+	C = 3
+
+	// D is the last constant
+	/*line ../1/1.go:16*/
+	D = 4
+)
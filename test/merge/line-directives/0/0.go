@@ -0,0 +1,37 @@
+package line
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Point is a point in the plane.
+type Point struct {
+	X, Y int
+}
+
+// Unit is the unit of the coordinates.
+type Unit int
+
+const (
+	Pixel Unit = iota
+	Inch
+)
+
+var (
+	Origin = Point{}
+	Scale  = 2
+)
+
+// String formats a point.
+func (p Point) String() string {
+	return fmt.Sprintf("(%d, %d)", p.X*Scale, p.Y*Scale)
+}
+
+func Join(points []Point) string {
+	s := []string{}
+	for _, p := range points {
+		s = append(s, p.String())
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,37 @@
+package line
+
+import "strings"
+
+// Point is a point in the plane.
+type Point struct {
+	X, Y int
+
+	// Label names the point
+	Label string
+}
+
+// Unit is the name of a unit.
+type Unit string
+
+const (
+	Meter Unit = "m"
+	Mile  Unit = "mi"
+)
+
+var (
+	Origin = Point{}
+	Scale  = 3
+	Labels = map[string]Point{}
+)
+
+func Join(points []Point) string {
+	s := []string{}
+	for _, p := range points {
+		s = append(s, p.Label)
+	}
+	return strings.Join(s, ";")
+}
+
+func Lookup(label string) Point {
+	return Labels[strings.ToLower(label)]
+}
@@ -0,0 +1,81 @@
+package out
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Point is a point in the plane.
+//
+//line ../0/0.go:9
+type Point struct {
+	X, Y int
+	// Label names the point
+	/*line ../1/1.go:9*/
+	Label string
+}
+
+// Unit is the unit of the coordinates.
+//
+//line ../0/0.go:14
+type Unit int
+
+//line ../0/0.go:16
+const (
+	Pixel Unit = iota
+	Inch
+)
+
+//line ../0/0.go:21
+var (
+	Origin = Point{}
+	Scale  = 2
+)
+
+// String formats a point.
+//
+//line ../0/0.go:27
+func (p Point) String() string {
+	return fmt.Sprintf("(%d, %d)", p.X*Scale, p.Y*Scale)
+}
+
+//line ../0/0.go:31
+func Join(points []Point) string {
+	s := []string{}
+	for _, p := range points {
+		s = append(s, p.String())
+	}
+	return strings.Join(s, ",")
+}
+
+// Unit1 is the name of a unit.
+//
+//line ../1/1.go:14
+type Unit1 string
+
+//line ../1/1.go:16
+const (
+	Meter Unit1 = "m"
+	Mile  Unit1 = "mi"
+)
+
+//line ../1/1.go:21
+var (
+	/*line ../1/1.go:22*/
+	Scale1 = 3
+	Labels = map[string]Point{}
+)
+
+//line ../1/1.go:27
+func Join1(points []Point) string {
+	s := []string{}
+	for _, p := range points {
+		s = append(s, p.Label)
+	}
+	return strings.Join(s, ";")
+}
+
+//line ../1/1.go:35
+func Lookup(label string) Point {
+	return Labels[strings.ToLower(label)]
+}
@@ -0,0 +1,21 @@
+package order
+
+func (l *Line) Length() int {
+	return l.To.X - l.From.X
+}
+
+var Origin = NewPoint(Zero, Zero)
+
+func NewPoint(x, y int) Point {
+	return Point{x, y}
+}
+
+type Line struct {
+	From, To Point
+}
+
+type Point struct {
+	X, Y int
+}
+
+const Zero = 0
@@ -0,0 +1,21 @@
+package out
+
+type Point struct {
+	X, Y int
+}
+
+func NewPoint(x, y int) Point {
+	return Point{x, y}
+}
+
+type Line struct {
+	From, To Point
+}
+
+func (l *Line) Length() int {
+	return l.To.X - l.From.X
+}
+
+const Zero = 0
+
+var Origin = NewPoint(Zero, Zero)
@@ -0,0 +1,19 @@
+package order
+
+type Point struct {
+	X, Y int
+}
+
+func (p Point) Add(o Point) Point {
+	return Point{p.X + o.X, p.Y + o.Y}
+}
+
+const Zero = 0
+
+type Line struct {
+	From, To Point
+}
+
+func NewPoint(x, y int) Point {
+	return Point{x, y}
+}
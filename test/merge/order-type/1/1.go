@@ -0,0 +1,36 @@
+package order
+
+func (l *Line) Length() int {
+	return l.To.X - l.From.X
+}
+
+var Origin = NewPoint(0, 0)
+
+func NewLine(from, to Point) *Line {
+	return &Line{from, to}
+}
+
+type Point struct {
+	X, Y int
+}
+
+type Line struct {
+	From, To Point
+}
+
+func NewPoint(x, y int) Point {
+	return Point{x, y}
+}
+
+func (k Kelvin) Celsius() Celsius {
+	return Celsius(k - 273)
+}
+
+type (
+	Celsius float64
+	Kelvin  float64
+)
+
+func NewKelvin(c Celsius) Kelvin {
+	return Kelvin(c + 273)
+}
@@ -0,0 +1,42 @@
+package out
+
+const Zero = 0
+
+var Origin = NewPoint(0, 0)
+
+type Point struct {
+	X, Y int
+}
+
+func NewPoint(x, y int) Point {
+	return Point{x, y}
+}
+
+func (p Point) Add(o Point) Point {
+	return Point{p.X + o.X, p.Y + o.Y}
+}
+
+type Line struct {
+	From, To Point
+}
+
+func NewLine(from, to Point) *Line {
+	return &Line{from, to}
+}
+
+func (l *Line) Length() int {
+	return l.To.X - l.From.X
+}
+
+type (
+	Celsius float64
+	Kelvin  float64
+)
+
+func NewKelvin(c Celsius) Kelvin {
+	return Kelvin(c + 273)
+}
+
+func (k Kelvin) Celsius() Celsius {
+	return Celsius(k - 273)
+}
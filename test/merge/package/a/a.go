@@ -0,0 +1,13 @@
+package a
+
+import "math/rand"
+
+type Foo int
+
+func init() {
+	rand.Seed(1)
+}
+
+func Random() Foo {
+	return Foo(rand.Int())
+}
@@ -0,0 +1,11 @@
+package b
+
+import "crypto/rand"
+
+func init() {
+	rand.Read(make([]byte, 1))
+}
+
+func NewFoo() *Foo {
+	return &Foo{n: newN()}
+}
@@ -0,0 +1,16 @@
+package b
+
+import "math/rand"
+
+type Foo struct {
+	n int
+}
+
+func newN() int {
+	return rand.Int()
+}
+
+// pick has a parameter named like the import
+func pick(rand []int) int {
+	return rand[0]
+}
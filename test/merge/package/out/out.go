@@ -0,0 +1,38 @@
+package out
+
+import (
+	randB "crypto/rand"
+	"math/rand"
+	rand2 "math/rand"
+)
+
+type Foo int
+
+func init() {
+	rand.Seed(1)
+}
+
+func Random() Foo {
+	return Foo(rand.Int())
+}
+
+func init() {
+	randB.Read(make([]byte, 1))
+}
+
+func NewFoo() *FooB {
+	return &FooB{n: newN()}
+}
+
+type FooB struct {
+	n int
+}
+
+func newN() int {
+	return rand2.Int()
+}
+
+// pick has a parameter named like the import
+func pick(rand []int) int {
+	return rand[0]
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 The Authors. All rights reserved.
+
+// Package provenance tests the origin annotations of merged declarations.
+package provenance
+
+import "strings"
+
+// Config configures a service.
+type Config struct {
+	// Name of the service
+	Name string
+}
+
+// Level is the log level.
+type Level int
+
+// Levels by their severity.
+const (
+	Debug Level = iota
+	Info
+)
+
+var (
+	// Default is in both files
+	Default = Config{Name: "default"}
+	// Prefix is only in this file
+	Prefix = strings.ToUpper("srv")
+)
+
+// Describe describes a config.
+func Describe(c Config) string {
+	return strings.ToUpper(c.Name)
+}
+
+func init() {
+	Default.Name = Prefix
+}
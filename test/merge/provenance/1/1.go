@@ -0,0 +1,40 @@
+// Copyright 2022 The Authors. All rights reserved.
+
+// Package provenance is documented in both files.
+package provenance
+
+import "strings"
+
+// Config configures a service.
+type Config struct {
+	// Name of the service
+	Name string
+
+	// Port of the service
+	Port int `json:"port"` // 0 picks a free port
+}
+
+// Level is the name of a log level.
+type Level string
+
+// Levels by their name.
+const (
+	Low  Level = "low"
+	High Level = "high"
+)
+
+var (
+	// Default is in both files
+	Default = Config{Name: "default"}
+	// Fallback is only in this file
+	Fallback = Default
+)
+
+// Describe describes a config.
+func Describe(c Config) string {
+	return strings.ToUpper(c.Name)
+}
+
+func init() {
+	Fallback.Port = 8080
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 The Authors. All rights reserved.
+
+// Package provenance tests the origin annotations of merged declarations.
+//
+// Package provenance is documented in both files.
+package out
+
+import "strings"
+
+// Config configures a service.
+//
+//srcmerge:origin Config ../0/0.go:9 duplicates=../1/1.go:9
+type Config struct {
+	// Name of the service
+	Name string
+	// Port of the service
+	//srcmerge:origin ../1/1.go:14
+	Port int `json:"port"` // 0 picks a free port
+}
+
+// Level is the log level.
+//
+//srcmerge:origin Level ../0/0.go:15
+type Level int
+
+// Levels by their severity.
+//
+//srcmerge:origin Debug ../0/0.go:19
+//srcmerge:origin Info ../0/0.go:20
+const (
+	Debug Level = iota
+	Info
+)
+
+//srcmerge:origin Default ../0/0.go:25 duplicates=../1/1.go:28
+//srcmerge:origin Prefix ../0/0.go:27
+var (
+	// Default is in both files
+	Default = Config{Name: "default"}
+	// Prefix is only in this file
+	Prefix = strings.ToUpper("srv")
+)
+
+// Describe describes a config.
+//
+//srcmerge:origin Describe ../0/0.go:31 duplicates=../1/1.go:34
+func Describe(c Config) string {
+	return strings.ToUpper(c.Name)
+}
+
+//srcmerge:origin init ../0/0.go:35
+func init() {
+	Default.Name = Prefix
+}
+
+// Level1 is the name of a log level.
+//
+//srcmerge:origin Level1 ../1/1.go:18 renamed=Level
+type Level1 string
+
+// Levels by their name.
+//
+//srcmerge:origin Low ../1/1.go:22
+//srcmerge:origin High ../1/1.go:23
+const (
+	Low  Level1 = "low"
+	High Level1 = "high"
+)
+
+//srcmerge:origin Fallback ../1/1.go:30
+var (
+	// Fallback is only in this file
+	Fallback = Default
+)
+
+//srcmerge:origin init ../1/1.go:38
+func init() {
+	Fallback.Port = 8080
+}
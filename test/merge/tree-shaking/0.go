@@ -0,0 +1,38 @@
+package shake
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Client struct {
+	name string
+	opts options
+}
+
+type options struct {
+	retries int
+}
+
+func NewClient(name string) *Client {
+	return &Client{name: name, opts: defaultOptions()}
+}
+
+func defaultOptions() options {
+	return options{retries: retries}
+}
+
+// Do is exported ... it is kept with its client
+func (c *Client) Do() string {
+	return c.format()
+}
+
+func (c *Client) format() string {
+	return fmt.Sprint(c.name, c.opts.retries)
+}
+
+func (c *Client) unused() {}
+
+func Unused() string {
+	return strings.ToUpper("unused")
+}
@@ -0,0 +1,24 @@
+package shake
+
+import "os"
+
+const (
+	retries = iota + 3
+	timeout
+)
+
+var debug = os.Getenv("DEBUG")
+
+var unusedValue = 1
+
+type namer interface {
+	name() string
+}
+
+type unusedType struct{}
+
+func (unusedType) name() string { return "" }
+
+func init() {
+	_ = debug
+}
@@ -0,0 +1,43 @@
+package out
+
+import (
+	"fmt"
+	"os"
+)
+
+type Client struct {
+	name string
+	opts options
+}
+
+type options struct {
+	retries int
+}
+
+func NewClient(name string) *Client {
+	return &Client{name: name, opts: defaultOptions()}
+}
+
+func defaultOptions() options {
+	return options{retries: retries}
+}
+
+// Do is exported ... it is kept with its client
+func (c *Client) Do() string {
+	return c.format()
+}
+
+func (c *Client) format() string {
+	return fmt.Sprint(c.name, c.opts.retries)
+}
+
+const (
+	retries = iota + 3
+	timeout
+)
+
+var debug = os.Getenv("DEBUG")
+
+func init() {
+	_ = debug
+}
@@ -0,0 +1,15 @@
+package app
+
+import "github.com/tfaller/go-srcmerge/test/packages/bundle/dep"
+
+type Cache struct {
+	store *dep.Store
+}
+
+func NewCache() *Cache {
+	return &Cache{store: dep.New(dep.DefaultSize)}
+}
+
+func (c *Cache) Put(key string) {
+	c.store.Add(key)
+}
@@ -0,0 +1,33 @@
+// Package dep is bundled into the app.
+package dep
+
+import "github.com/tfaller/go-srcmerge/test/packages/bundle/dep/internal/util"
+
+// DefaultSize of a store
+const DefaultSize = 16
+
+// Store stores keys
+type Store struct {
+	keys []string
+}
+
+// New creates a store
+func New(size int) *Store {
+	return &Store{keys: make([]string, 0, util.Grow(size))}
+}
+
+// Add adds a key
+func (s *Store) Add(key string) {
+	s.keys = append(s.keys, key)
+}
+
+// Stats of a store
+type Stats struct {
+	DefaultSize int
+}
+
+// Stats returns the stats of the store
+func (s *Store) Stats() Stats {
+	New := len(s.keys)
+	return Stats{DefaultSize: DefaultSize + New}
+}
@@ -0,0 +1,6 @@
+package util
+
+// Grow returns the grown size
+func Grow(size int) int {
+	return size * 2
+}
@@ -0,0 +1,47 @@
+package out
+
+type Cache struct {
+	store *depStore
+}
+
+func NewCache() *Cache {
+	return &Cache{store: depNew(depDefaultSize)}
+}
+
+func (c *Cache) Put(key string) {
+	c.store.Add(key)
+}
+
+// deputilGrow returns the grown size
+func deputilGrow(size int) int {
+	return size * 2
+}
+
+// depDefaultSize of a store
+const depDefaultSize = 16
+
+// depStore stores keys
+type depStore struct {
+	keys []string
+}
+
+// depNew creates a store
+func depNew(size int) *depStore {
+	return &depStore{keys: make([]string, 0, deputilGrow(size))}
+}
+
+// Add adds a key
+func (s *depStore) Add(key string) {
+	s.keys = append(s.keys, key)
+}
+
+// depStats of a store
+type depStats struct {
+	DefaultSize int
+}
+
+// Stats returns the stats of the store
+func (s *depStore) Stats() depStats {
+	New := len(s.keys)
+	return depStats{DefaultSize: depDefaultSize + New}
+}
@@ -0,0 +1,11 @@
+package a
+
+import "github.com/tfaller/go-srcmerge/test/packages/refs/b"
+
+type Foo int
+
+func Wrap(f Foo) *b.Foo {
+	return b.New(int(f))
+}
+
+var Default = b.Limit
@@ -0,0 +1,11 @@
+package b
+
+type Foo struct {
+	n int
+}
+
+const Limit = 10
+
+func New(n int) *Foo {
+	return &Foo{n: n}
+}
@@ -0,0 +1,19 @@
+package out
+
+type Foo int
+
+func Wrap(f Foo) *FooB {
+	return New(int(f))
+}
+
+var Default = Limit
+
+type FooB struct {
+	n int
+}
+
+const Limit = 10
+
+func New(n int) *FooB {
+	return &FooB{n: n}
+}